@@ -0,0 +1,227 @@
+package main
+
+import (
+	"errors"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+	"strconv"
+)
+
+func (app *application) listUsersHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Search    string
+		Activated *bool
+		data.Filters
+	}
+
+	v := validator.NewValidator()
+	qs := r.URL.Query()
+
+	input.Search = app.readString(qs, "q", "")
+	input.Activated = app.readBool(qs, "activated", v)
+
+	input.Filters.Sort = app.readString(qs, "sort", "id")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	input.Filters.SortSafeList = []string{"id", "name", "email", "created_at", "-id", "-name", "-email", "-created_at"}
+
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := app.models.Users.GetAll(input.Search, input.Activated, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"metadata": metadata, "users": users}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	deletionScheduledAt, err := app.models.Users.GetDeletionSchedule(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"user":                  user,
+		"permissions":           permissions,
+		"deletion_scheduled_at": deletionScheduledAt,
+	}
+
+	err = app.writeJson(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateUserActivationHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Activated *bool `json:"activated"`
+		Version   *int  `json:"version"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if v.Check(input.Activated != nil, "activated", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if input.Version != nil && *input.Version != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	user.Activated = *input.Activated
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.Activated {
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+	} else {
+		err = app.revokeAllSessions(user.ID)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteUserSessionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.revokeAllSessions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "user has been logged out of all sessions"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createUserPasswordResetHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.sendPasswordResetEmail(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusAccepted, envelope{"message": "password reset instructions have been sent to the user"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showUserLockoutHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	throttle, err := app.models.LoginThrottles.Get(data.ThrottleAccount, strconv.FormatInt(user.ID, 10))
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			throttle = &data.LoginThrottle{}
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	env := envelope{
+		"lockout": envelope{
+			"locked":          throttle.Locked(),
+			"failed_attempts": throttle.Failures,
+			"last_failure_at": throttle.LastFailureAt,
+			"locked_until":    throttle.LockedUntil,
+		},
+	}
+
+	err = app.writeJson(w, http.StatusOK, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteUserLockoutHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.LoginThrottles.Reset(data.ThrottleAccount, strconv.FormatInt(id, 10))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "account successfully unlocked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+)
+
+// The handlers below serve both personal collections; each route binds them to
+// one with data.CollectionWatchlist or data.CollectionWatched.
+
+func (app *application) listCollectionHandler(collection string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		var filters data.Filters
+
+		v := validator.NewValidator()
+		qs := r.URL.Query()
+
+		filters.Sort = app.readString(qs, "sort", "position")
+		filters.Page = app.readInt(qs, "page", 1, v)
+		filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+		filters.SortSafeList = []string{"position", "added_at", "title", "-position", "-added_at", "-title"}
+
+		if data.ValidateFilters(v, filters); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		userID := app.contextGetUser(r).ID
+		orgID := app.contextGetOrganization(r).ID
+
+		entries, metadata, err := app.models.Collections.GetAll(userID, collection, orgID, filters)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJson(w, http.StatusOK, envelope{"metadata": metadata, collection: entries}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (app *application) putCollectionEntryHandler(collection string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		movie, ok := app.readMovieParamNamed(w, r, "movie_id")
+		if !ok {
+			return
+		}
+
+		userID := app.contextGetUser(r).ID
+
+		entry, err := app.models.Collections.Get(userID, collection, movie.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				entry = &data.CollectionEntry{MovieID: movie.ID}
+			default:
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		var input struct {
+			Position *int    `json:"position"`
+			Notes    *string `json:"notes"`
+		}
+
+		err = app.readJson(w, r, &input)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if input.Position != nil {
+			entry.Position = *input.Position
+		}
+		if input.Notes != nil {
+			entry.Notes = *input.Notes
+		}
+
+		v := validator.NewValidator()
+
+		if data.ValidateCollectionEntry(v, entry); !v.Valid() {
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		err = app.models.Collections.Put(userID, collection, entry)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		entry.Movie = movie
+
+		err = app.writeJson(w, http.StatusOK, envelope{"entry": entry}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
+
+func (app *application) deleteCollectionEntryHandler(collection string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		movie, ok := app.readMovieParamNamed(w, r, "movie_id")
+		if !ok {
+			return
+		}
+
+		err := app.models.Collections.Delete(app.contextGetUser(r).ID, collection, movie.ID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.writeJson(w, http.StatusOK, envelope{"message": "movie successfully removed from " + collection}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+	}
+}
@@ -8,7 +8,13 @@ import (
 
 type userContext string
 
-const userContextKey = userContext("user")
+const (
+	userContextKey   = userContext("user")
+	tokenContextKey  = userContext("token")
+	familyContextKey = userContext("family")
+	apiKeyContextKey = userContext("api_key")
+	orgContextKey    = userContext("organization")
+)
 
 func (app *application) contextSetUser(r *http.Request, user *data.User) *http.Request {
 	ctx := context.WithValue(r.Context(), userContextKey, user)
@@ -23,3 +29,47 @@ func (app *application) contextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+func (app *application) contextSetToken(r *http.Request, token string) *http.Request {
+	ctx := context.WithValue(r.Context(), tokenContextKey, token)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetToken(r *http.Request) string {
+	token, ok := r.Context().Value(tokenContextKey).(string)
+	if !ok {
+		panic("missing values in token context")
+	}
+
+	return token
+}
+
+func (app *application) contextSetFamily(r *http.Request, family string) *http.Request {
+	ctx := context.WithValue(r.Context(), familyContextKey, family)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetFamily(r *http.Request) string {
+	family, _ := r.Context().Value(familyContextKey).(string)
+	return family
+}
+
+func (app *application) contextSetAPIKey(r *http.Request, key *data.APIKey) *http.Request {
+	ctx := context.WithValue(r.Context(), apiKeyContextKey, key)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetAPIKey(r *http.Request) *data.APIKey {
+	key, _ := r.Context().Value(apiKeyContextKey).(*data.APIKey)
+	return key
+}
+
+func (app *application) contextSetOrganization(r *http.Request, org *data.Organization) *http.Request {
+	ctx := context.WithValue(r.Context(), orgContextKey, org)
+	return r.WithContext(ctx)
+}
+
+func (app *application) contextGetOrganization(r *http.Request) *data.Organization {
+	org, _ := r.Context().Value(orgContextKey).(*data.Organization)
+	return org
+}
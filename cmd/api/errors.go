@@ -3,6 +3,8 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (app *application) logError(r *http.Request, err error) {
@@ -89,3 +91,24 @@ func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Requ
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (app *application) notMemberResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you are not a member of this organization"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) invalidAPIKeyResponse(w http.ResponseWriter, r *http.Request) {
+	message := "invalid or expired api key"
+	app.errorResponse(w, r, http.StatusUnauthorized, message)
+}
+
+func (app *application) apiKeyNotAllowedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this resource can not be accessed with an api key"
+	app.errorResponse(w, r, http.StatusForbidden, message)
+}
+
+func (app *application) loginLockedResponse(w http.ResponseWriter, r *http.Request, lockedUntil time.Time) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(lockedUntil).Seconds())+1))
+	message := "too many failed login attempts, please try again later"
+	app.errorResponse(w, r, http.StatusTooManyRequests, message)
+}
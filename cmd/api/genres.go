@@ -0,0 +1,192 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+)
+
+func (app *application) listGenresHandler(w http.ResponseWriter, r *http.Request) {
+
+	genres, err := app.models.Genres.GetAll(app.contextGetOrganization(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"genres": genres}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createGenreHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Slug    string   `json:"slug"`
+		Name    string   `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// The slug defaults to one derived from the name.
+	if input.Slug == "" {
+		input.Slug = data.GenreSlug(input.Name)
+	}
+
+	genre := &data.Genre{
+		Slug:    input.Slug,
+		Name:    input.Name,
+		Aliases: genreAliases(input.Aliases),
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateGenre(v, genre); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Genres.Insert(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGenre):
+			app.errorResponse(w, r, http.StatusConflict, "a genre with this slug or alias already exists")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/genres/%d", genre.ID))
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"genre": genre}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateGenreHandler(w http.ResponseWriter, r *http.Request) {
+
+	genre, ok := app.readGenreParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Slug    *string  `json:"slug"`
+		Name    *string  `json:"name"`
+		Aliases []string `json:"aliases"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Slug != nil {
+		genre.Slug = *input.Slug
+	}
+	if input.Name != nil {
+		genre.Name = *input.Name
+	}
+	if input.Aliases != nil {
+		genre.Aliases = genreAliases(input.Aliases)
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateGenre(v, genre); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Genres.Update(genre)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateGenre):
+			app.errorResponse(w, r, http.StatusConflict, "a genre with this slug or alias already exists")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"genre": genre}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteGenreHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Genres.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, data.ErrGenreInUse):
+			app.errorResponse(w, r, http.StatusConflict, "the genre is still used by movies and cannot be deleted")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "genre successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// genreAliases converts free-text aliases such as "Sci Fi" to the slug form
+// they are matched in.
+func genreAliases(aliases []string) []string {
+
+	slugs := make([]string, len(aliases))
+
+	for i, alias := range aliases {
+		slugs[i] = data.GenreSlug(alias)
+	}
+
+	return slugs
+}
+
+func (app *application) readGenreParam(w http.ResponseWriter, r *http.Request) (*data.Genre, bool) {
+
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	genre, err := app.models.Genres.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return genre, true
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"greenlight/internal/validator"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -15,17 +16,36 @@ import (
 )
 
 func (app *application) readIdParam(r *http.Request) (int64, error) {
+	return app.readIdParamNamed(r, "id")
+}
+
+func (app *application) readIdParamNamed(r *http.Request, name string) (int64, error) {
 	params := httprouter.ParamsFromContext(r.Context())
 
-	id, err := strconv.ParseInt(params.ByName("id"), 10, 64)
+	id, err := strconv.ParseInt(params.ByName(name), 10, 64)
 
 	if err != nil || id < 1 {
-		return 0, errors.New("invalid id param")
+		return 0, fmt.Errorf("invalid %s param", name)
 	}
 
 	return id, nil
 }
 
+func (app *application) readStringParam(r *http.Request, name string) string {
+	params := httprouter.ParamsFromContext(r.Context())
+
+	return params.ByName(name)
+}
+
+func (app *application) clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
+
 type envelope map[string]any
 
 func (app *application) writeJson(w http.ResponseWriter, status int, data envelope, headers http.Header) error {
@@ -141,6 +161,24 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	return i
 }
 
+func (app *application) readBool(qs url.Values, key string, v *validator.Validator) *bool {
+
+	s := qs.Get(key)
+
+	if s == "" {
+		return nil
+	}
+
+	b, err := strconv.ParseBool(s)
+
+	if err != nil {
+		v.AddError(key, "must be a boolean value")
+		return nil
+	}
+
+	return &b
+}
+
 func (app *application) background(fn func()) {
 
 	app.wg.Add(1)
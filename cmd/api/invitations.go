@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+	"time"
+)
+
+func (app *application) createInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email       string   `json:"email"`
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	data.ValidateEmail(v, input.Email)
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkPermissionsExist(w, r, v, "permissions", input.Permissions) {
+		return
+	}
+
+	_, err = app.models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "a user with this email address already exists")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	inviter, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	invitation := &data.Invitation{
+		InvitedBy:   inviter.ID,
+		Email:       input.Email,
+		Permissions: input.Permissions,
+	}
+
+	if invitation.Permissions == nil {
+		invitation.Permissions = data.PermissionsList{}
+	}
+
+	token, err := app.models.Invitations.New(invitation, app.config.users.invitationTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+
+		data := map[string]any{
+			"inviterName":     inviter.Name,
+			"invitationToken": token.Plaintext,
+			"expiry":          token.Expiry.Format(time.RFC1123),
+		}
+
+		err := app.mailer.Send(invitation.Email, "user_invitation.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	err = app.writeJson(w, http.StatusAccepted, envelope{"invitation": invitation}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,541 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+)
+
+func (app *application) listListsHandler(w http.ResponseWriter, r *http.Request) {
+
+	var filters data.Filters
+
+	v := validator.NewValidator()
+	qs := r.URL.Query()
+
+	mine := app.readBool(qs, "mine", v)
+
+	filters.Sort = app.readString(qs, "sort", "-updated_at")
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.SortSafeList = []string{"id", "title", "created_at", "updated_at", "-id", "-title", "-created_at", "-updated_at"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	orgID := app.contextGetOrganization(r).ID
+	userID := app.contextGetUser(r).ID
+
+	lists, metadata, err := app.models.Lists.GetAllVisible(orgID, userID, mine != nil && *mine, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"metadata": metadata, "lists": lists}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createListHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Visibility  string `json:"visibility"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	list := &data.List{
+		OrganizationID: app.contextGetOrganization(r).ID,
+		OwnerID:        app.contextGetUser(r).ID,
+		Title:          input.Title,
+		Description:    input.Description,
+		Visibility:     input.Visibility,
+	}
+
+	if list.Visibility == "" {
+		list.Visibility = data.ListPrivate
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Insert(list)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/lists/%d", list.ID))
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"list": list}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showListHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateListHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeListManage(w, r, list) {
+		return
+	}
+
+	var input struct {
+		Title       *string `json:"title"`
+		Description *string `json:"description"`
+		Visibility  *string `json:"visibility"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Title != nil {
+		list.Title = *input.Title
+	}
+	if input.Description != nil {
+		list.Description = *input.Description
+	}
+	if input.Visibility != nil {
+		list.Visibility = *input.Visibility
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateList(v, list); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Update(list)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"list": list}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteListHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeListManage(w, r, list) {
+		return
+	}
+
+	err := app.models.Lists.Delete(list.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "list successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listListItemsHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.NewValidator()
+	qs := r.URL.Query()
+
+	filters.Sort = app.readString(qs, "sort", "position")
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.SortSafeList = []string{"position", "added_at", "title", "-position", "-added_at", "-title"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	items, metadata, err := app.models.Lists.GetItems(list.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"metadata": metadata, "items": items}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) putListItemHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeListEdit(w, r, list) {
+		return
+	}
+
+	movie, ok := app.readMovieParamNamed(w, r, "movie_id")
+	if !ok {
+		return
+	}
+
+	item, err := app.models.Lists.GetItem(list.ID, movie.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			userID := app.contextGetUser(r).ID
+			item = &data.ListItem{MovieID: movie.ID, AddedBy: &userID}
+		default:
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	var input struct {
+		Position *int    `json:"position"`
+		Notes    *string `json:"notes"`
+	}
+
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Position != nil {
+		item.Position = *input.Position
+	}
+	if input.Notes != nil {
+		item.Notes = *input.Notes
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateListItem(v, item); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.PutItem(list.ID, item)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	item.Movie = movie
+
+	err = app.writeJson(w, http.StatusOK, envelope{"item": item}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteListItemHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeListEdit(w, r, list) {
+		return
+	}
+
+	movieID, err := app.readIdParamNamed(r, "movie_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Lists.DeleteItem(list.ID, movieID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "movie successfully removed from list"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) reorderListHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeListEdit(w, r, list) {
+		return
+	}
+
+	var input struct {
+		MovieIDs []int64 `json:"movie_ids"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+	qs := r.URL.Query()
+
+	// The reordered items are returned a page at a time, like listing them.
+	filters := data.Filters{Sort: "position", SortSafeList: []string{"position"}}
+
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	data.ValidateFilters(v, filters)
+	v.Check(input.MovieIDs != nil, "movie_ids", "must be provided")
+	v.Check(validator.Unique(input.MovieIDs), "movie_ids", "must not contain duplicate values")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.Reorder(list.ID, input.MovieIDs)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrInvalidOrder):
+			v.AddError("movie_ids", "must contain every movie on the list exactly once")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	items, metadata, err := app.models.Lists.GetItems(list.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"metadata": metadata, "items": items}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listListCollaboratorsHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	collaborators, err := app.models.Lists.GetCollaborators(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"collaborators": collaborators}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) addListCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeListManage(w, r, list) {
+		return
+	}
+
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err == nil {
+		_, err = app.models.Organizations.GetForMember(list.OrganizationID, user.ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("email", "no matching member of this organization found")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if user.ID == list.OwnerID {
+		v.AddError("email", "the owner of a list can not be a collaborator")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Lists.AddCollaborator(list.ID, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCollaborator):
+			app.errorResponse(w, r, http.StatusConflict, "the user is already a collaborator on this list")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	collaborators, err := app.models.Lists.GetCollaborators(list.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"collaborators": collaborators}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeListCollaboratorHandler(w http.ResponseWriter, r *http.Request) {
+
+	list, ok := app.readListParam(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := app.readIdParamNamed(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Collaborators may leave a list on their own.
+	if userID != app.contextGetUser(r).ID && !app.authorizeListManage(w, r, list) {
+		return
+	}
+
+	err = app.models.Lists.RemoveCollaborator(list.ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "collaborator successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readListParam loads the list named by the :id URL parameter from the
+// request's organization. Lists the user may not see are reported as missing.
+func (app *application) readListParam(w http.ResponseWriter, r *http.Request) (*data.List, bool) {
+
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	list, err := app.models.Lists.Get(app.contextGetOrganization(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !app.authorizeListView(w, r, list) {
+		return nil, false
+	}
+
+	return list, true
+}
@@ -6,6 +6,7 @@ import (
 	"expvar"
 	"flag"
 	"greenlight/internal/data"
+	"greenlight/internal/jwt"
 	"greenlight/internal/mailer"
 	"log/slog"
 	"os"
@@ -45,14 +46,41 @@ type config struct {
 	cors struct {
 		trustedOrigins []string
 	}
+	users struct {
+		deletionGracePeriod time.Duration
+		defaultPermissions  []string
+		defaultOrganization string
+		inviteOnly          bool
+		invitationTTL       time.Duration
+	}
+	permissions struct {
+		cacheTTL time.Duration
+	}
+	genres struct {
+		cacheTTL time.Duration
+	}
+	lockout struct {
+		account data.LockoutPolicy
+		ip      data.LockoutPolicy
+	}
+	tokens struct {
+		accessTTL    time.Duration
+		refreshTTL   time.Duration
+		mode         string
+		keyFile      string
+		issuer       string
+		syncInterval time.Duration
+	}
 }
 
 type application struct {
-	config config
-	logger *slog.Logger
-	models data.Models
-	mailer mailer.Mailer
-	wg     sync.WaitGroup
+	config      config
+	logger      *slog.Logger
+	models      data.Models
+	mailer      mailer.Mailer
+	keys        *jwt.KeySet
+	revocations *revocationList
+	wg          sync.WaitGroup
 }
 
 func main() {
@@ -73,20 +101,58 @@ func main() {
 	flag.IntVar(&cfg.limiter.burst, "limiter-burst", 4, "Rate limiter maximum burst")
 	flag.BoolVar(&cfg.limiter.enabled, "limiter-enabled", true, "Enable rate limiter")
 
+	flag.DurationVar(&cfg.users.deletionGracePeriod, "account-deletion-grace-period", 30*24*time.Hour, "Time between an account deletion request and its hard deletion")
+
+	flag.DurationVar(&cfg.permissions.cacheTTL, "permissions-cache-ttl", time.Minute, "How long a user's permissions are cached in memory (0 disables the cache)")
+	flag.DurationVar(&cfg.genres.cacheTTL, "genres-cache-ttl", time.Minute, "How long the genre taxonomy is cached in memory (0 disables the cache)")
+
+	flag.BoolVar(&cfg.users.inviteOnly, "invite-only", false, "Only allow registration with an invitation token")
+	flag.DurationVar(&cfg.users.invitationTTL, "invitation-ttl", 7*24*time.Hour, "Invitation token lifetime")
+
+	flag.StringVar(&cfg.users.defaultOrganization, "default-organization", "default", "Slug of the organization newly registered users join (empty to disable)")
+
+	cfg.users.defaultPermissions = []string{"movies:read"}
+	flag.Func("default-permissions", "Permission codes granted to newly registered users (default \"movies:read\")", func(codes string) error {
+		cfg.users.defaultPermissions = strings.Fields(codes)
+		return nil
+	})
+
+	flag.IntVar(&cfg.lockout.account.Threshold, "lockout-account-threshold", 5, "Failed logins before an account is locked")
+	flag.IntVar(&cfg.lockout.ip.Threshold, "lockout-ip-threshold", 20, "Failed logins before a client IP is locked")
+	flag.DurationVar(&cfg.lockout.account.Window, "lockout-window", 15*time.Minute, "Period after which failed logins are forgotten")
+	flag.DurationVar(&cfg.lockout.account.BaseLockout, "lockout-base-duration", time.Minute, "Lock duration once the threshold is reached, doubled on every further failure")
+	flag.DurationVar(&cfg.lockout.account.MaxLockout, "lockout-max-duration", time.Hour, "Maximum lock duration")
+
 	flag.StringVar(&cfg.smtp.host, "smtp-host", "sandbox.smtp.mailtrap.io", "SMTP host")
 	flag.IntVar(&cfg.smtp.port, "smtp-port", 2525, "SMTP port")
 	flag.StringVar(&cfg.smtp.username, "smtp-username", "e232f848e817e2", "SMTP username")
 	flag.StringVar(&cfg.smtp.password, "smtp-password", "75d0eaa05e52d4", "SMTP password")
 	flag.StringVar(&cfg.smtp.sender, "smtp-sender", "Greenlight <no-reply@greenlight.alexedwards.net>", "SMTP sender")
 
+	flag.DurationVar(&cfg.tokens.accessTTL, "access-token-ttl", 15*time.Minute, "Authentication (access) token lifetime")
+	flag.DurationVar(&cfg.tokens.refreshTTL, "refresh-token-ttl", 30*24*time.Hour, "Refresh token lifetime")
+	flag.StringVar(&cfg.tokens.mode, "token-mode", "opaque", "Authentication token format (opaque|jwt)")
+	flag.StringVar(&cfg.tokens.keyFile, "jwt-key-file", os.Getenv("GREENLIGHT_JWT_KEY_FILE"), "Path to the JSON file holding the JWT signing keys")
+	flag.StringVar(&cfg.tokens.issuer, "jwt-issuer", "greenlight", "JWT issuer claim")
+	flag.DurationVar(&cfg.tokens.syncInterval, "jwt-sync-interval", 30*time.Second, "Interval for reloading JWT keys and revoked sessions")
+
 	flag.Func("cors-trusted-origins", "Trusted CORS origin ", func(origins string) error {
 		cfg.cors.trustedOrigins = strings.Fields(origins)
 		return nil
 	})
 	flag.Parse()
 
+	cfg.lockout.ip.Window = cfg.lockout.account.Window
+	cfg.lockout.ip.BaseLockout = cfg.lockout.account.BaseLockout
+	cfg.lockout.ip.MaxLockout = cfg.lockout.account.MaxLockout
+
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 
+	if cfg.tokens.mode != "opaque" && cfg.tokens.mode != "jwt" {
+		logger.Error("invalid token mode", "mode", cfg.tokens.mode)
+		os.Exit(1)
+	}
+
 	db, err := openDB(cfg)
 	if err != nil {
 		logger.Error(err.Error())
@@ -96,15 +162,41 @@ func main() {
 	defer db.Close()
 	logger.Info("database connection pool established")
 
-	model := data.NewModels(db)
+	model := data.NewModels(db, cfg.permissions.cacheTTL, cfg.genres.cacheTTL)
+
+	// AddForUser skips codes that don't exist, so a typo here would otherwise
+	// leave new users with no permissions at all.
+	unknown, err := model.Permissions.Unknown(cfg.users.defaultPermissions...)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	if len(unknown) > 0 {
+		logger.Error("unknown default permissions", "codes", unknown)
+		os.Exit(1)
+	}
 
 	app := application{
-		config: cfg,
-		logger: logger,
-		models: model,
-		mailer: mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		config:      cfg,
+		logger:      logger,
+		models:      model,
+		mailer:      mailer.New(cfg.smtp.host, cfg.smtp.port, cfg.smtp.username, cfg.smtp.password, cfg.smtp.sender),
+		revocations: newRevocationList(),
+	}
+
+	if cfg.tokens.mode == "jwt" {
+		app.keys, err = jwt.LoadKeySet(cfg.tokens.keyFile)
+		if err != nil {
+			logger.Error(err.Error())
+			os.Exit(1)
+		}
+
+		go app.syncRevocations()
 	}
 
+	go app.purgeDeletedUsers()
+
 	expvar.NewString("version").Set(version)
 
 	expvar.Publish("goroutines", expvar.Func(func() any {
@@ -115,6 +207,10 @@ func main() {
 		return db.Stats()
 	}))
 
+	expvar.Publish("permissions_cache", expvar.Func(func() any {
+		return app.models.Permissions.Cache.Stats()
+	}))
+
 	expvar.Publish("timestamp", expvar.Func(func() any {
 		return time.Now().Unix()
 	}))
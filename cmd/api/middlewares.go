@@ -5,9 +5,10 @@ import (
 	"expvar"
 	"fmt"
 	"greenlight/internal/data"
+	"greenlight/internal/jwt"
 	"greenlight/internal/validator"
-	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -61,12 +62,7 @@ func (app *application) rateLimitMiddleware(next http.HandlerFunc) http.HandlerF
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.limiter.enabled {
-			ip, _, err := net.SplitHostPort(r.Host)
-
-			if err != nil {
-				app.serverErrorResponse(w, r, err)
-				return
-			}
+			ip := app.clientIP(r)
 
 			mu.Lock()
 
@@ -95,6 +91,39 @@ func (app *application) authenticateMiddleware(next http.HandlerFunc) http.Handl
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
 		w.Header().Add("Vary", "Authorization")
+		w.Header().Add("Vary", "X-API-Key")
+
+		if apiKey := r.Header.Get("X-API-Key"); apiKey != "" {
+			v := validator.NewValidator()
+
+			if data.ValidateAPIKeyPlaintext(v, apiKey); !v.Valid() {
+				app.invalidAPIKeyResponse(w, r)
+				return
+			}
+
+			key, user, err := app.models.APIKeys.GetForPlaintext(apiKey)
+			if err != nil {
+				switch {
+				case errors.Is(err, data.ErrRecordNotFound):
+					app.invalidAPIKeyResponse(w, r)
+				default:
+					app.serverErrorResponse(w, r, err)
+				}
+				return
+			}
+
+			err = app.models.APIKeys.Touch(key.ID)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetAPIKey(r, key)
+
+			next(w, r)
+			return
+		}
 
 		authorizationHeader := r.Header.Get("Authorization")
 
@@ -105,12 +134,33 @@ func (app *application) authenticateMiddleware(next http.HandlerFunc) http.Handl
 		}
 
 		headerParts := strings.Split(authorizationHeader, " ")
-		if len(headerParts) != 2 && headerParts[0] != "Bearer" {
+		if len(headerParts) != 2 || headerParts[0] != "Bearer" {
 			app.invalidAuthenticationTokenResponse(w, r)
 			return
 		}
 
 		token := headerParts[1]
+
+		if app.statelessTokens() && jwt.IsToken(token) {
+			claims, err := app.keys.Verify(token, app.config.tokens.issuer)
+			if err != nil || app.revocations.revoked(claims.Family) {
+				app.invalidAuthenticationTokenResponse(w, r)
+				return
+			}
+
+			user := &data.User{
+				ID:        claims.Subject,
+				Activated: claims.Activated,
+			}
+
+			r = app.contextSetUser(r, user)
+			r = app.contextSetToken(r, token)
+			r = app.contextSetFamily(r, claims.Family)
+
+			next(w, r)
+			return
+		}
+
 		v := validator.NewValidator()
 
 		if data.ValidateTokenPlaintext(v, token); !v.Valid() {
@@ -129,7 +179,14 @@ func (app *application) authenticateMiddleware(next http.HandlerFunc) http.Handl
 			return
 		}
 
+		err = app.models.Tokens.Touch(token, app.clientIP(r), r.UserAgent())
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
 		r = app.contextSetUser(r, user)
+		r = app.contextSetToken(r, token)
 
 		next(w, r)
 	})
@@ -169,19 +226,54 @@ func (app *application) requireActivatedUserMiddleware(next http.HandlerFunc) ht
 	return app.requireAuthenticatedUserMiddleware(fn)
 }
 
-func (app *application) requirePermissionsMiddleware(code string, next http.HandlerFunc) http.HandlerFunc {
+// requireSessionMiddleware rejects requests authenticated with an API key, so
+// that a leaked key can't be used to mint new keys or manage the account.
+func (app *application) requireSessionMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
-		user := app.contextGetUser(r)
+		if app.contextGetAPIKey(r) != nil {
+			app.apiKeyNotAllowedResponse(w, r)
+			return
+		}
+
+		next(w, r)
+	})
+
+	return app.requireAuthenticatedUserMiddleware(fn)
+}
 
-		permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+func (app *application) requirePermissionsMiddleware(code string, next http.HandlerFunc) http.HandlerFunc {
+	return app.requireAllPermissionsMiddleware([]string{code}, next)
+}
+
+// requireAnyPermissionMiddleware lets the request through when the user holds
+// at least one of the codes.
+func (app *application) requireAnyPermissionMiddleware(codes []string, next http.HandlerFunc) http.HandlerFunc {
+	return app.requirePermissionsMatchMiddleware(func(permissions data.PermissionsList) bool {
+		return permissions.IncludesAny(codes...)
+	}, next)
+}
+
+// requireAllPermissionsMiddleware lets the request through only when the user
+// holds every one of the codes.
+func (app *application) requireAllPermissionsMiddleware(codes []string, next http.HandlerFunc) http.HandlerFunc {
+	return app.requirePermissionsMatchMiddleware(func(permissions data.PermissionsList) bool {
+		return permissions.IncludesAll(codes...)
+	}, next)
+}
+
+func (app *application) requirePermissionsMatchMiddleware(allowed func(data.PermissionsList) bool, next http.HandlerFunc) http.HandlerFunc {
+
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		permissions, err := app.permissionsForRequest(r)
 		if err != nil {
 			app.serverErrorResponse(w, r, err)
 			return
 		}
 
-		if !permissions.Includes(code) {
+		if !allowed(permissions) {
 			app.notPermittedResponse(w, r)
 			return
 		}
@@ -192,6 +284,84 @@ func (app *application) requirePermissionsMiddleware(code string, next http.Hand
 	return app.requireActivatedUserMiddleware(fn)
 }
 
+// requireOrganizationMiddleware resolves the organization the request acts
+// in: the :org_id path parameter, else the X-Organization-ID header, else the
+// organization the user joined first. The user must be a member of it.
+func (app *application) requireOrganizationMiddleware(next http.HandlerFunc) http.HandlerFunc {
+
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		w.Header().Add("Vary", "X-Organization-ID")
+
+		user := app.contextGetUser(r)
+
+		param := app.readStringParam(r, "org_id")
+		if param == "" {
+			param = r.Header.Get("X-Organization-ID")
+		}
+
+		var (
+			org *data.Organization
+			err error
+		)
+
+		if param == "" {
+			org, err = app.models.Organizations.GetDefaultForMember(user.ID)
+		} else {
+			id, parseErr := strconv.ParseInt(param, 10, 64)
+			if parseErr != nil || id < 1 {
+				app.notFoundResponse(w, r)
+				return
+			}
+
+			org, err = app.models.Organizations.GetForMember(id, user.ID)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				app.notMemberResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		r = app.contextSetOrganization(r, org)
+
+		next(w, r)
+	})
+
+	return app.requireActivatedUserMiddleware(fn)
+}
+
+// permissionsForRequest returns the permissions of the current user, within
+// the request's organization if it has one, narrowed down to the ones granted
+// to the API key when the request used one.
+func (app *application) permissionsForRequest(r *http.Request) (data.PermissionsList, error) {
+
+	user := app.contextGetUser(r)
+
+	var (
+		permissions data.PermissionsList
+		err         error
+	)
+
+	if org := app.contextGetOrganization(r); org != nil {
+		permissions, err = app.models.Permissions.GetAllForMember(org.ID, user.ID)
+	} else {
+		permissions, err = app.models.Permissions.GetAllForUser(user.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if key := app.contextGetAPIKey(r); key != nil {
+		permissions = permissions.Restrict(key.Permissions)
+	}
+
+	return permissions, nil
+}
+
 func (app *application) enableCORS(next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 
@@ -207,7 +377,7 @@ func (app *application) enableCORS(next http.HandlerFunc) http.HandlerFunc {
 				if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 
 					w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+					w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, X-API-Key, X-Organization-ID")
 
 					w.WriteHeader(http.StatusOK)
 					return
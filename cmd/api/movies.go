@@ -24,16 +24,26 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	movie := &data.Movie{
 		Title:   input.Title,
 		Year:    int32(input.Year),
 		Runtime: input.Runtime,
-		Genres:  input.Genres,
+		Genres:  genres.Canonical(input.Genres),
 	}
 
+	user := app.contextGetUser(r)
+	movie.CreatedBy = &user.ID
+	movie.OrganizationID = app.contextGetOrganization(r).ID
+
 	v := validator.NewValidator()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -41,7 +51,7 @@ func (app *application) createMovieHandler(w http.ResponseWriter, r *http.Reques
 	err = app.models.Movies.Insert(movie)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
-
+		return
 	}
 
 	header := make(http.Header)
@@ -64,7 +74,7 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(app.contextGetOrganization(r).ID, id)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -76,6 +86,12 @@ func (app *application) showMovieHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	movie.Credits, err = app.models.Credits.GetAllForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	err = app.writeJson(w, http.StatusOK, envelope{"movie": movie}, nil)
 
 	if err != nil {
@@ -94,7 +110,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	movie, err := app.models.Movies.Get(id)
+	movie, err := app.models.Movies.Get(app.contextGetOrganization(r).ID, id)
 
 	if err != nil {
 		switch {
@@ -107,6 +123,10 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !app.authorizeMovieWrite(w, r, movie) {
+		return
+	}
+
 	var input struct {
 		Title   *string       `json:"title"`
 		Year    *int          `json:"year"`
@@ -124,8 +144,14 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 	if input.Title != nil {
 		movie.Title = *input.Title
 	}
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
 	if input.Genres != nil {
-		movie.Genres = input.Genres
+		movie.Genres = genres.Canonical(input.Genres)
 	}
 	if input.Runtime != nil {
 		movie.Runtime = *input.Runtime
@@ -136,7 +162,7 @@ func (app *application) updateMovieHandler(w http.ResponseWriter, r *http.Reques
 
 	v := validator.NewValidator()
 
-	if data.ValidateMovie(v, movie); !v.Valid() {
+	if data.ValidateMovie(v, movie, genres); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
@@ -171,7 +197,23 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Movies.Delete(id)
+	movie, err := app.models.Movies.Get(app.contextGetOrganization(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.authorizeMovieWrite(w, r, movie) {
+		return
+	}
+
+	err = app.models.Movies.Delete(movie.OrganizationID, movie.ID)
 
 	if err != nil {
 		switch {
@@ -193,30 +235,44 @@ func (app *application) deleteMovieHandler(w http.ResponseWriter, r *http.Reques
 func (app *application) listMovieHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
-		Title  string
-		Genres []string
+		data.MovieQuery
 		data.Filters
 	}
 
 	v := validator.NewValidator()
 	qs := r.URL.Query()
 
+	input.OrganizationID = app.contextGetOrganization(r).ID
+	input.UserID = app.contextGetUser(r).ID
+
 	input.Title = app.readString(qs, "title", "")
 	input.Genres = app.readCSV(qs, "genres", []string{})
+	input.OnWatchlist = app.readBool(qs, "on_watchlist", v)
+	input.Watched = app.readBool(qs, "watched", v)
+	input.Director = int64(app.readInt(qs, "director", 0, v))
+	input.Actor = int64(app.readInt(qs, "actor", 0, v))
 
 	input.Filters.Sort = app.readString(qs, "sort", "id")
 
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 
-	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "-id", "-title", "-year", "-runtime"}
+	input.Filters.SortSafeList = []string{"id", "title", "year", "runtime", "average_rating", "rating_count", "-id", "-title", "-year", "-runtime", "-average_rating", "-rating_count"}
 
-	if data.ValidateFilters(v, input.Filters); v.Valid() {
+	if data.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	movies, metadata, err := app.models.Movies.GetAll(input.Title, input.Genres, input.Filters)
+	genres, err := app.models.Genres.Lookup()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	input.Genres = genres.Canonical(input.Genres)
+
+	movies, metadata, err := app.models.Movies.GetAll(input.MovieQuery, input.Filters)
 
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
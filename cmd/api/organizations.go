@@ -0,0 +1,383 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+	"time"
+)
+
+// organizationOwnerPermissions are granted within a new organization to the
+// user it is created for, so that they can run its catalogue.
+var organizationOwnerPermissions = []string{"orgs:admin", "movies:read", "movies:write", "movies:write:any"}
+
+func (app *application) listCurrentUserOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	orgs, err := app.models.Organizations.GetAllForUser(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"organizations": orgs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+
+	permissions, err := app.permissionsForRequest(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"organization": app.contextGetOrganization(r), "permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+
+	orgs, err := app.models.Organizations.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"organizations": orgs}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name    string `json:"name"`
+		Slug    string `json:"slug"`
+		OwnerID *int64 `json:"owner_id"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	org := &data.Organization{
+		Name: input.Name,
+		Slug: input.Slug,
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateOrganization(v, org); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	ownerID := app.contextGetUser(r).ID
+
+	if input.OwnerID != nil {
+		owner, err := app.models.Users.Get(*input.OwnerID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("owner_id", "no matching user found")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		ownerID = owner.ID
+	}
+
+	err = app.models.Organizations.Insert(org, ownerID, organizationOwnerPermissions...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateSlug):
+			v.AddError("slug", "an organization with this slug already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/orgs/%d", org.ID))
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"organization": org}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listOrganizationMembersHandler(w http.ResponseWriter, r *http.Request) {
+
+	members, err := app.models.Organizations.GetAllMembers(app.contextGetOrganization(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"members": members}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// addOrganizationMemberHandler invites a registered user to join the
+// organization; they only become a member once they accept. The response is
+// the same whether or not the email address belongs to anyone, so it can't be
+// used to find out who has an account.
+func (app *application) addOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email       string   `json:"email"`
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	data.ValidateEmail(v, input.Email)
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkPermissionsExist(w, r, v, "permissions", input.Permissions) {
+		return
+	}
+
+	if input.Permissions == nil {
+		input.Permissions = []string{}
+	}
+
+	env := envelope{"message": "an invitation will be sent to the email address if it belongs to a registered user"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeJson(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	org := app.contextGetOrganization(r)
+
+	_, err = app.models.Organizations.GetMember(org.ID, user.ID)
+	switch {
+	case err == nil:
+		// Already a member, so there's nothing to accept.
+		err = app.writeJson(w, http.StatusAccepted, env, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	inviter, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Organizations.Invite(org.ID, inviter.ID, user.ID, input.Permissions, app.config.users.invitationTTL)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+
+		data := map[string]any{
+			"inviterName":      inviter.Name,
+			"organizationName": org.Name,
+			"invitationToken":  token.Plaintext,
+			"expiry":           token.Expiry.Format(time.RFC1123),
+		}
+
+		err := app.mailer.Send(user.Email, "organization_invitation.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	err = app.writeJson(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) acceptOrganizationInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateTokenPlaintext(v, input.Token); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	id, err := app.models.Organizations.AcceptInvitation(user.ID, input.Token)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation token")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrAlreadyMember):
+			app.errorResponse(w, r, http.StatusConflict, "you are already a member of this organization")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	member, err := app.models.Organizations.GetMember(id, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	org, err := app.models.Organizations.Get(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/orgs/%d", org.ID))
+
+	err = app.writeJson(w, http.StatusOK, envelope{"organization": org, "member": member}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateOrganizationMemberPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	member, ok := app.readMemberParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkPermissionsExist(w, r, v, "permissions", input.Permissions) {
+		return
+	}
+
+	org := app.contextGetOrganization(r)
+
+	err = app.models.Permissions.SetForMember(org.ID, member.UserID, input.Permissions...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	member, err = app.models.Organizations.GetMember(org.ID, member.UserID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"member": member}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+
+	member, ok := app.readMemberParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Organizations.RemoveMember(app.contextGetOrganization(r).ID, member.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMemberParam loads the member of the request's organization named by the
+// :user_id URL parameter, sending a 404 if there is none.
+func (app *application) readMemberParam(w http.ResponseWriter, r *http.Request) (*data.Member, bool) {
+
+	userID, err := app.readIdParamNamed(r, "user_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	member, err := app.models.Organizations.GetMember(app.contextGetOrganization(r).ID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return member, true
+}
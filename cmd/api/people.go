@@ -0,0 +1,417 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+)
+
+func (app *application) listPeopleHandler(w http.ResponseWriter, r *http.Request) {
+
+	var filters data.Filters
+
+	v := validator.NewValidator()
+	qs := r.URL.Query()
+
+	name := app.readString(qs, "name", "")
+
+	filters.Sort = app.readString(qs, "sort", "name")
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.SortSafeList = []string{"id", "name", "birth_year", "-id", "-name", "-birth_year"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	people, metadata, err := app.models.People.GetAll(app.contextGetOrganization(r).ID, name, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"metadata": metadata, "people": people}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createPersonHandler(w http.ResponseWriter, r *http.Request) {
+
+	var input struct {
+		Name      string `json:"name"`
+		BirthYear *int32 `json:"birth_year"`
+		Bio       string `json:"bio"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	person := &data.Person{
+		OrganizationID: app.contextGetOrganization(r).ID,
+		Name:           input.Name,
+		BirthYear:      input.BirthYear,
+		Bio:            input.Bio,
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidatePerson(v, person); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.People.Insert(person)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/people/%d", person.ID))
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"person": person}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showPersonHandler(w http.ResponseWriter, r *http.Request) {
+
+	person, ok := app.readPersonParam(w, r)
+	if !ok {
+		return
+	}
+
+	credits, err := app.models.Credits.GetAllForPerson(person.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"person": person, "credits": credits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// People aren't owned by anyone, and are shared by every movie crediting them,
+// so changing or deleting one takes movies:write:any (see routes).
+func (app *application) updatePersonHandler(w http.ResponseWriter, r *http.Request) {
+
+	person, ok := app.readPersonParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name      *string `json:"name"`
+		BirthYear *int32  `json:"birth_year"`
+		Bio       *string `json:"bio"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		person.Name = *input.Name
+	}
+	if input.BirthYear != nil {
+		person.BirthYear = input.BirthYear
+	}
+	if input.Bio != nil {
+		person.Bio = *input.Bio
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidatePerson(v, person); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.People.Update(person)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"person": person}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deletePersonHandler(w http.ResponseWriter, r *http.Request) {
+
+	person, ok := app.readPersonParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.People.Delete(person.OrganizationID, person.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "person successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listMovieCreditsHandler(w http.ResponseWriter, r *http.Request) {
+
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return
+	}
+
+	credits, err := app.models.Credits.GetAllForMovie(movie.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"credits": credits}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createMovieCreditHandler(w http.ResponseWriter, r *http.Request) {
+
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeMovieWrite(w, r, movie) {
+		return
+	}
+
+	var input struct {
+		PersonID     int64  `json:"person_id"`
+		Role         string `json:"role"`
+		Character    string `json:"character"`
+		BillingOrder int    `json:"billing_order"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	credit := &data.Credit{
+		MovieID:      movie.ID,
+		PersonID:     input.PersonID,
+		Role:         input.Role,
+		Character:    input.Character,
+		BillingOrder: input.BillingOrder,
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateCredit(v, credit); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// The person must be in the same organization as the movie.
+	_, err = app.models.People.Get(movie.OrganizationID, credit.PersonID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("person_id", "does not exist")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Credits.Insert(credit)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCredit):
+			app.errorResponse(w, r, http.StatusConflict, "this person is already credited in this role")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	credit, err = app.models.Credits.Get(movie.ID, credit.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d/credits/%d", movie.ID, credit.ID))
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"credit": credit}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateMovieCreditHandler(w http.ResponseWriter, r *http.Request) {
+
+	movie, credit, ok := app.readCreditParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeMovieWrite(w, r, movie) {
+		return
+	}
+
+	var input struct {
+		Role         *string `json:"role"`
+		Character    *string `json:"character"`
+		BillingOrder *int    `json:"billing_order"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Role != nil {
+		credit.Role = *input.Role
+	}
+	if input.Character != nil {
+		credit.Character = *input.Character
+	}
+	if input.BillingOrder != nil {
+		credit.BillingOrder = *input.BillingOrder
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateCredit(v, credit); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Credits.Update(credit)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateCredit):
+			app.errorResponse(w, r, http.StatusConflict, "this person is already credited in this role")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"credit": credit}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieCreditHandler(w http.ResponseWriter, r *http.Request) {
+
+	movie, credit, ok := app.readCreditParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeMovieWrite(w, r, movie) {
+		return
+	}
+
+	err := app.models.Credits.Delete(credit.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "credit successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readPersonParam loads the person named by the :id URL parameter from the
+// request's organization, sending a 404 if there is none.
+func (app *application) readPersonParam(w http.ResponseWriter, r *http.Request) (*data.Person, bool) {
+
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	person, err := app.models.People.Get(app.contextGetOrganization(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return person, true
+}
+
+// readCreditParam loads the credit named by the :credit_id URL parameter,
+// along with the movie named by :id that it must belong to.
+func (app *application) readCreditParam(w http.ResponseWriter, r *http.Request) (*data.Movie, *data.Credit, bool) {
+
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+
+	id, err := app.readIdParamNamed(r, "credit_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, nil, false
+	}
+
+	credit, err := app.models.Credits.Get(movie.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, nil, false
+	}
+
+	return movie, credit, true
+}
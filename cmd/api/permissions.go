@@ -0,0 +1,197 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+	"strings"
+)
+
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	permissions, err := app.models.Permissions.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	permission := &data.Permission{Code: input.Code}
+
+	v := validator.NewValidator()
+
+	if data.ValidatePermissionCode(v, permission.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Permissions.Insert(permission)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicatePermission):
+			v.AddError("code", "a permission with this code already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"permission": permission}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) grantUserPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Codes []string `json:"codes"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	v.Check(len(input.Codes) >= 1, "codes", "must contain at least 1 permission")
+	v.Check(validator.Unique(input.Codes), "codes", "must not contain duplicate values")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkPermissionsExist(w, r, v, "codes", input.Codes) {
+		return
+	}
+
+	err = app.models.Permissions.AddForUser(user.ID, input.Codes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) revokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Permissions.RemoveForUser(user.ID, app.readStringParam(r, "code"))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// checkPermissionsExist sends a failed validation response and returns false
+// when any of the codes is not a known permission.
+func (app *application) checkPermissionsExist(w http.ResponseWriter, r *http.Request, v *validator.Validator, key string, codes []string) bool {
+
+	unknown, err := app.models.Permissions.Unknown(codes...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if len(unknown) > 0 {
+		v.AddError(key, fmt.Sprintf("unknown permissions: %s", strings.Join(unknown, ", ")))
+		app.failedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	return true
+}
+
+// readUserParam loads the user named by the :id route parameter, sending the
+// error response itself when that fails.
+func (app *application) readUserParam(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
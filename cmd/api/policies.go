@@ -0,0 +1,113 @@
+package main
+
+import (
+	"greenlight/internal/data"
+	"net/http"
+)
+
+// Object-level authorization. The route middleware has already checked that
+// the user may perform the action at all; these policies decide whether they
+// may perform it on a particular record. Each one sends the error response
+// itself and returns false when the request must stop.
+
+// authorizeOwnerOrPermission allows the owner of a record, or anyone holding
+// the elevated permission code. Records with no owner need the permission.
+func (app *application) authorizeOwnerOrPermission(w http.ResponseWriter, r *http.Request, ownerID *int64, code string) bool {
+
+	user := app.contextGetUser(r)
+
+	if ownerID != nil && *ownerID == user.ID {
+		return true
+	}
+
+	permissions, err := app.permissionsForRequest(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !permissions.Includes(code) {
+		app.notPermittedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// authorizeMovieWrite lets editors change the movies they created, and
+// holders of movies:write:any change every movie.
+func (app *application) authorizeMovieWrite(w http.ResponseWriter, r *http.Request, movie *data.Movie) bool {
+	return app.authorizeOwnerOrPermission(w, r, movie.CreatedBy, "movies:write:any")
+}
+
+// authorizeReviewUpdate only lets the author edit their review.
+func (app *application) authorizeReviewUpdate(w http.ResponseWriter, r *http.Request, review *data.Review) bool {
+
+	if review.UserID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// authorizeReviewDelete lets the author, or a holder of reviews:moderate,
+// delete a review.
+func (app *application) authorizeReviewDelete(w http.ResponseWriter, r *http.Request, review *data.Review) bool {
+	return app.authorizeOwnerOrPermission(w, r, &review.UserID, "reviews:moderate")
+}
+
+// authorizeListView hides private lists from everyone but their owner and
+// collaborators, answering 404 so that their existence isn't revealed.
+func (app *application) authorizeListView(w http.ResponseWriter, r *http.Request, list *data.List) bool {
+
+	if list.Visibility != data.ListPrivate || list.OwnerID == app.contextGetUser(r).ID {
+		return true
+	}
+
+	collaborator, err := app.models.Lists.IsCollaborator(list.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !collaborator {
+		app.notFoundResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// authorizeListEdit lets the owner and collaborators change a list's items.
+func (app *application) authorizeListEdit(w http.ResponseWriter, r *http.Request, list *data.List) bool {
+
+	if list.OwnerID == app.contextGetUser(r).ID {
+		return true
+	}
+
+	collaborator, err := app.models.Lists.IsCollaborator(list.ID, app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return false
+	}
+
+	if !collaborator {
+		app.notPermittedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// authorizeListManage only lets the owner change a list's details and
+// collaborators, or delete it.
+func (app *application) authorizeListManage(w http.ResponseWriter, r *http.Request, list *data.List) bool {
+
+	if list.OwnerID != app.contextGetUser(r).ID {
+		app.notPermittedResponse(w, r)
+		return false
+	}
+
+	return true
+}
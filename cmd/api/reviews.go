@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+)
+
+func (app *application) listMovieReviewsHandler(w http.ResponseWriter, r *http.Request) {
+
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return
+	}
+
+	var filters data.Filters
+
+	v := validator.NewValidator()
+	qs := r.URL.Query()
+
+	filters.Sort = app.readString(qs, "sort", "-created_at")
+	filters.Page = app.readInt(qs, "page", 1, v)
+	filters.PageSize = app.readInt(qs, "page_size", 20, v)
+
+	filters.SortSafeList = []string{"created_at", "updated_at", "rating", "-created_at", "-updated_at", "-rating"}
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	reviews, metadata, err := app.models.Reviews.GetAllForMovie(movie.ID, filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"metadata": metadata, "reviews": reviews}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createMovieReviewHandler(w http.ResponseWriter, r *http.Request) {
+
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Rating int32  `json:"rating"`
+		Body   string `json:"body"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	review := &data.Review{
+		MovieID: movie.ID,
+		UserID:  app.contextGetUser(r).ID,
+		Rating:  input.Rating,
+		Body:    input.Body,
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Insert(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateReview):
+			app.errorResponse(w, r, http.StatusConflict, "you have already reviewed this movie")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	review, err = app.models.Reviews.Get(movie.ID, review.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/movies/%d/reviews/%d", movie.ID, review.ID))
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"review": review}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showMovieReviewHandler(w http.ResponseWriter, r *http.Request) {
+
+	review, ok := app.readReviewParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.writeJson(w, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateMovieReviewHandler(w http.ResponseWriter, r *http.Request) {
+
+	review, ok := app.readReviewParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeReviewUpdate(w, r, review) {
+		return
+	}
+
+	var input struct {
+		Rating *int32  `json:"rating"`
+		Body   *string `json:"body"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Rating != nil {
+		review.Rating = *input.Rating
+	}
+	if input.Body != nil {
+		review.Body = *input.Body
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateReview(v, review); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Reviews.Update(review)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"review": review}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteMovieReviewHandler(w http.ResponseWriter, r *http.Request) {
+
+	review, ok := app.readReviewParam(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.authorizeReviewDelete(w, r, review) {
+		return
+	}
+
+	err := app.models.Reviews.Delete(review.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "review successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// readMovieParam loads the movie named by the :id URL parameter from the
+// request's organization, sending a 404 if there is none.
+func (app *application) readMovieParam(w http.ResponseWriter, r *http.Request) (*data.Movie, bool) {
+	return app.readMovieParamNamed(w, r, "id")
+}
+
+func (app *application) readMovieParamNamed(w http.ResponseWriter, r *http.Request, name string) (*data.Movie, bool) {
+
+	id, err := app.readIdParamNamed(r, name)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	movie, err := app.models.Movies.Get(app.contextGetOrganization(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return movie, true
+}
+
+// readReviewParam loads the review named by the :review_id URL parameter,
+// which must belong to the movie named by :id.
+func (app *application) readReviewParam(w http.ResponseWriter, r *http.Request) (*data.Review, bool) {
+
+	movie, ok := app.readMovieParam(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	id, err := app.readIdParamNamed(r, "review_id")
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	review, err := app.models.Reviews.Get(movie.ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return review, true
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// revocationList is the in-process copy of the token_revocations table. In jwt
+// mode authenticateMiddleware consults it instead of the database, so a
+// revoked session stops working on this instance immediately and on the others
+// after the next sync.
+type revocationList struct {
+	mu       sync.RWMutex
+	families map[string]time.Time
+}
+
+func newRevocationList() *revocationList {
+	return &revocationList{families: make(map[string]time.Time)}
+}
+
+func (l *revocationList) add(expiry time.Time, families ...string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, family := range families {
+		l.families[family] = expiry
+	}
+}
+
+func (l *revocationList) revoked(family string) bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	expiry, found := l.families[family]
+	return found && time.Now().Before(expiry)
+}
+
+func (l *revocationList) merge(families map[string]time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for family, expiry := range l.families {
+		if _, found := families[family]; !found && time.Now().Before(expiry) {
+			families[family] = expiry
+		}
+	}
+
+	l.families = families
+}
+
+func (app *application) statelessTokens() bool {
+	return app.config.tokens.mode == "jwt"
+}
+
+// revokeSessions makes sure access tokens already handed out for the given
+// families are rejected. Opaque tokens are deleted from the database by the
+// caller, so there is nothing to do for them here.
+func (app *application) revokeSessions(families ...string) error {
+	if !app.statelessTokens() || len(families) == 0 {
+		return nil
+	}
+
+	expiry := time.Now().Add(app.config.tokens.accessTTL)
+
+	err := app.models.Revocations.Insert(expiry, families...)
+	if err != nil {
+		return err
+	}
+
+	app.revocations.add(expiry, families...)
+	return nil
+}
+
+func (app *application) revokeAllSessions(userID int64) error {
+
+	if app.statelessTokens() {
+		families, err := app.models.Tokens.GetAllFamiliesForUser(userID)
+		if err != nil {
+			return err
+		}
+
+		err = app.revokeSessions(families...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return app.models.Tokens.DeleteAllSessionsForUser(userID)
+}
+
+func (app *application) syncRevocations() {
+	for {
+		revocations, err := app.models.Revocations.GetAllActive()
+		if err != nil {
+			app.logger.Error(err.Error())
+		} else {
+			families := make(map[string]time.Time, len(revocations))
+			for _, revocation := range revocations {
+				families[revocation.Family] = revocation.Expiry
+			}
+			app.revocations.merge(families)
+		}
+
+		err = app.models.Revocations.DeleteExpired()
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		err = app.keys.Reload()
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		time.Sleep(app.config.tokens.syncInterval)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"greenlight/internal/data"
+	"greenlight/internal/validator"
+	"net/http"
+	"strings"
+)
+
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+
+	roles, err := app.models.Roles.GetAll()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string   `json:"name"`
+		Description string   `json:"description"`
+		Permissions []string `json:"permissions"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	role := &data.Role{
+		Name:        input.Name,
+		Description: input.Description,
+		Permissions: input.Permissions,
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateRole(v, role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkPermissionsExist(w, r, v, "permissions", role.Permissions) {
+		return
+	}
+
+	err = app.models.Roles.Insert(role)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateRole):
+			v.AddError("name", "a role with this name already exists")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/v1/admin/roles/%d", role.ID))
+
+	err = app.writeJson(w, http.StatusCreated, envelope{"role": role}, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showRoleHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	role, err := app.models.Roles.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"role": role}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	role, err := app.models.Roles.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Permissions []string `json:"permissions"`
+	}
+
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	role.Permissions = input.Permissions
+
+	v := validator.NewValidator()
+
+	if data.ValidateRole(v, role); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !app.checkPermissionsExist(w, r, v, "permissions", role.Permissions) {
+		return
+	}
+
+	err = app.models.Roles.SetPermissions(role.ID, role.Permissions...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"role": role}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteRoleHandler(w http.ResponseWriter, r *http.Request) {
+
+	id, err := app.readIdParam(r)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	err = app.models.Roles.Delete(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "role successfully deleted"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) assignUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Roles []string `json:"roles"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	v.Check(len(input.Roles) >= 1, "roles", "must contain at least 1 role")
+	v.Check(validator.Unique(input.Roles), "roles", "must not contain duplicate values")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	unknown, err := app.models.Roles.Unknown(input.Roles...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if len(unknown) > 0 {
+		v.AddError("roles", fmt.Sprintf("unknown roles: %s", strings.Join(unknown, ", ")))
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Roles.AssignToUser(user.ID, input.Roles...)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) removeUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, ok := app.readUserParam(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Roles.RemoveFromUser(user.ID, app.readStringParam(r, "role"))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	roles, err := app.models.Roles.GetAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"roles": roles}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
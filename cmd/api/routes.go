@@ -2,6 +2,7 @@ package main
 
 import (
 	"expvar"
+	"greenlight/internal/data"
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
@@ -16,15 +17,138 @@ func (app *application) routes() http.Handler {
 
 	router.HandlerFunc(http.MethodGet, "/v1/healthcheck", app.healthcheckHandler)
 
-	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requirePermissionsMiddleware("movies:read", app.listMovieHandler))
-	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requirePermissionsMiddleware("movies:write", app.createMovieHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requirePermissionsMiddleware("movies:read", app.showMovieHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requirePermissionsMiddleware("movies:write", app.updateMovieHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requirePermissionsMiddleware("movies:write", app.deleteMovieHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/movies", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listMovieHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:write", app.createMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.showMovieHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.updateMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.deleteMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listMovieReviewsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/reviews", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.createMovieReviewHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/reviews/:review_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.showMovieReviewHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/reviews/:review_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.updateMovieReviewHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/reviews/:review_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.deleteMovieReviewHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/movies/:id/credits", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listMovieCreditsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/movies/:id/credits", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.createMovieCreditHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/movies/:id/credits/:credit_id", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.updateMovieCreditHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/movies/:id/credits/:credit_id", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.deleteMovieCreditHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/genres", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listGenresHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/people", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listPeopleHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/people", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:write", app.createPersonHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/people/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.showPersonHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/people/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:write:any", app.updatePersonHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/people/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:write:any", app.deletePersonHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/lists", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listListsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/lists", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.createListHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.showListHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/lists/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.updateListHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.deleteListHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id/items", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listListItemsHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/lists/:id/items/:movie_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.putListItemHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/items/:movie_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.deleteListItemHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/lists/:id/order", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.reorderListHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/lists/:id/collaborators", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listListCollaboratorsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/lists/:id/collaborators", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.addListCollaboratorHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/lists/:id/collaborators/:user_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.removeListCollaboratorHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/orgs", app.requireActivatedUserMiddleware(app.listCurrentUserOrganizationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id", app.requireOrganizationMiddleware(app.showOrganizationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/members", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("orgs:admin", app.listOrganizationMembersHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs/:org_id/members", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("orgs:admin", app.addOrganizationMemberHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/orgs/:org_id/members/:user_id/permissions", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("orgs:admin", app.updateOrganizationMemberPermissionsHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:org_id/members/:user_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("orgs:admin", app.removeOrganizationMemberHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/movies", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listMovieHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs/:org_id/movies", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:write", app.createMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/movies/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.showMovieHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/orgs/:org_id/movies/:id", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.updateMovieHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:org_id/movies/:id", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.deleteMovieHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/movies/:id/reviews", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listMovieReviewsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs/:org_id/movies/:id/reviews", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.createMovieReviewHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/movies/:id/reviews/:review_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.showMovieReviewHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/orgs/:org_id/movies/:id/reviews/:review_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.updateMovieReviewHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:org_id/movies/:id/reviews/:review_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.deleteMovieReviewHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/movies/:id/credits", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listMovieCreditsHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs/:org_id/movies/:id/credits", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.createMovieCreditHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/orgs/:org_id/movies/:id/credits/:credit_id", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.updateMovieCreditHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:org_id/movies/:id/credits/:credit_id", app.requireOrganizationMiddleware(app.requireAnyPermissionMiddleware([]string{"movies:write", "movies:write:any"}, app.deleteMovieCreditHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/genres", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listGenresHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/people", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listPeopleHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs/:org_id/people", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:write", app.createPersonHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/people/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.showPersonHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/orgs/:org_id/people/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:write:any", app.updatePersonHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:org_id/people/:id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:write:any", app.deletePersonHandler)))
 
 	router.HandlerFunc(http.MethodPost, "/v1/users", app.registerUserHandler)
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.activateUserHandler)
+	router.HandlerFunc(http.MethodPut, "/v1/users/password", app.updateUserPasswordHandler)
+	router.HandlerFunc(http.MethodGet, "/v1/users/me", app.requireAuthenticatedUserMiddleware(app.showCurrentUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/me", app.requireSessionMiddleware(app.updateCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me", app.requireSessionMiddleware(app.deleteCurrentUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/deletion", app.requireSessionMiddleware(app.cancelCurrentUserDeletionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/export", app.requireSessionMiddleware(app.exportCurrentUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watchlist", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listCollectionHandler(data.CollectionWatchlist))))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/watchlist/:movie_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.putCollectionEntryHandler(data.CollectionWatchlist))))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watchlist/:movie_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.deleteCollectionEntryHandler(data.CollectionWatchlist))))
+	router.HandlerFunc(http.MethodGet, "/v1/users/me/watched", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.listCollectionHandler(data.CollectionWatched))))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/watched/:movie_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.putCollectionEntryHandler(data.CollectionWatched))))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/watched/:movie_id", app.requireOrganizationMiddleware(app.requirePermissionsMiddleware("movies:read", app.deleteCollectionEntryHandler(data.CollectionWatched))))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/organizations", app.requireActivatedUserMiddleware(app.acceptOrganizationInvitationHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/password", app.requireSessionMiddleware(app.updateCurrentUserPasswordHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/email", app.requireSessionMiddleware(app.requestEmailChangeHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/email", app.confirmEmailChangeHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/totp", app.requireSessionMiddleware(app.requirePermissionsMiddleware("movies:write", app.createTOTPEnrolmentHandler)))
+	router.HandlerFunc(http.MethodPut, "/v1/users/me/totp", app.requireSessionMiddleware(app.requirePermissionsMiddleware("movies:write", app.confirmTOTPEnrolmentHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/me/totp", app.requireSessionMiddleware(app.requireActivatedUserMiddleware(app.deleteTOTPEnrolmentHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/users/me/totp/recovery-codes", app.requireSessionMiddleware(app.requireActivatedUserMiddleware(app.regenerateRecoveryCodesHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/tokens", app.requireSessionMiddleware(app.listSessionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/sessions/:id", app.requireSessionMiddleware(app.deleteSessionHandler))
 	router.HandlerFunc(http.MethodPost, "/v1/tokens/authentication", app.createAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/mfa", app.createMFAAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/refresh", app.refreshAuthenticationTokenHandler)
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication", app.requireSessionMiddleware(app.deleteAuthenticationTokenHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/tokens/authentication/all", app.requireSessionMiddleware(app.deleteAllAuthenticationTokensHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/password-reset", app.createPasswordResetTokenHandler)
+	router.HandlerFunc(http.MethodPost, "/v1/tokens/activation", app.createActivationTokenHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys", app.requireSessionMiddleware(app.requireActivatedUserMiddleware(app.listAPIKeysHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/api-keys", app.requireSessionMiddleware(app.requireActivatedUserMiddleware(app.createAPIKeyHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/api-keys/:id", app.requireSessionMiddleware(app.requireActivatedUserMiddleware(app.showAPIKeyHandler)))
+	router.HandlerFunc(http.MethodPatch, "/v1/api-keys/:id", app.requireSessionMiddleware(app.requireActivatedUserMiddleware(app.updateAPIKeyHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/api-keys/:id", app.requireSessionMiddleware(app.requireActivatedUserMiddleware(app.deleteAPIKeyHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/permissions", app.requirePermissionsMiddleware("users:admin", app.listPermissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/permissions", app.requirePermissionsMiddleware("users:admin", app.createPermissionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles", app.requirePermissionsMiddleware("users:admin", app.listRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/roles", app.requirePermissionsMiddleware("users:admin", app.createRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/roles/:id", app.requirePermissionsMiddleware("users:admin", app.showRoleHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/roles/:id/permissions", app.requirePermissionsMiddleware("users:admin", app.updateRolePermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/roles/:id", app.requirePermissionsMiddleware("users:admin", app.deleteRoleHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/admin/genres", app.requirePermissionsMiddleware("genres:admin", app.createGenreHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/admin/genres/:id", app.requirePermissionsMiddleware("genres:admin", app.updateGenreHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/genres/:id", app.requirePermissionsMiddleware("genres:admin", app.deleteGenreHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/admin/invitations", app.requirePermissionsMiddleware("users:admin", app.createInvitationHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/orgs", app.requirePermissionsMiddleware("users:admin", app.listOrganizationsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/orgs", app.requirePermissionsMiddleware("users:admin", app.createOrganizationHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users", app.requirePermissionsMiddleware("users:admin", app.listUsersHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id", app.requirePermissionsMiddleware("users:admin", app.showUserHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/admin/users/:id/activated", app.requirePermissionsMiddleware("users:admin", app.updateUserActivationHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/sessions", app.requirePermissionsMiddleware("users:admin", app.deleteUserSessionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/password-reset", app.requirePermissionsMiddleware("users:admin", app.createUserPasswordResetHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/permissions", app.requirePermissionsMiddleware("users:admin", app.listUserPermissionsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/permissions", app.requirePermissionsMiddleware("users:admin", app.grantUserPermissionsHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/permissions/:code", app.requirePermissionsMiddleware("users:admin", app.revokeUserPermissionHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/roles", app.requirePermissionsMiddleware("users:admin", app.listUserRolesHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/admin/users/:id/roles", app.requirePermissionsMiddleware("users:admin", app.assignUserRolesHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/roles/:role", app.requirePermissionsMiddleware("users:admin", app.removeUserRoleHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/admin/users/:id/lockout", app.requirePermissionsMiddleware("users:admin", app.showUserLockoutHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/admin/users/:id/lockout", app.requirePermissionsMiddleware("users:admin", app.deleteUserLockoutHandler))
 
 	router.HandlerFunc(http.MethodGet, "/debug/vars", expvar.Handler().ServeHTTP)
 	return app.metricsMiddleware(app.recoverPanicMiddleware(app.enableCORS(app.rateLimitMiddleware(app.authenticateMiddleware(router.ServeHTTP)))))
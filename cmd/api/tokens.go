@@ -3,8 +3,10 @@ package main
 import (
 	"errors"
 	"greenlight/internal/data"
+	"greenlight/internal/jwt"
 	"greenlight/internal/validator"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -29,18 +31,46 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
+	ip := app.clientIP(r)
+
+	throttle, err := app.models.LoginThrottles.Get(data.ThrottleIP, ip)
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if throttle != nil && throttle.Locked() {
+		app.loginLockedResponse(w, r, *throttle.LockedUntil)
+		return
+	}
+
 	user, err := app.models.Users.GetByEmail(input.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.recordFailedLogin(ip, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
 			app.invalidCredentialsResponse(w, r)
-			return
 		default:
 			app.serverErrorResponse(w, r, err)
 		}
 		return
 	}
 
+	throttle, err = app.models.LoginThrottles.Get(data.ThrottleAccount, strconv.FormatInt(user.ID, 10))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if throttle != nil && throttle.Locked() {
+		app.loginLockedResponse(w, r, *throttle.LockedUntil)
+		return
+	}
+
 	match, err := user.Password.Match(input.Password)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
@@ -48,19 +78,543 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 	}
 
 	if !match {
+		err = app.recordFailedLogin(ip, user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	mfaEnabled, err := app.models.TOTP.Enabled(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if mfaEnabled {
+		token, err := app.models.Tokens.New(user.ID, 5*time.Minute, data.ScopeMFAPending)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		err = app.writeJson(w, http.StatusAccepted, envelope{"mfa_required": true, "mfa_token": token}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// The account throttle is only cleared once the whole login succeeds, so
+	// knowing the password doesn't reset the count of failed codes.
+	err = app.models.LoginThrottles.Reset(data.ThrottleAccount, strconv.FormatInt(user.ID, 10))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	family, err := data.GenerateFamily()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tokens, err := app.newSessionTokens(r, user, family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusCreated, tokens, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+
+}
+
+func (app *application) createMFAAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	data.ValidateTokenPlaintext(v, input.MFAToken)
+	if input.RecoveryCode == "" {
+		data.ValidateTOTPCode(v, input.Code)
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopeMFAPending, input.MFAToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	throttle, err := app.models.LoginThrottles.Get(data.ThrottleAccount, strconv.FormatInt(user.ID, 10))
+	if err != nil && !errors.Is(err, data.ErrRecordNotFound) {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if throttle != nil && throttle.Locked() {
+		app.loginLockedResponse(w, r, *throttle.LockedUntil)
+		return
+	}
+
+	var valid bool
+
+	if input.RecoveryCode != "" {
+		valid, err = app.models.TOTP.UseRecoveryCode(user.ID, input.RecoveryCode)
+	} else {
+		valid, err = app.verifyTOTPCode(user.ID, input.Code)
+	}
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !valid {
+		err = app.recordFailedLogin(app.clientIP(r), user)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 		app.invalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeAuthentication)
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeMFAPending, user.ID)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	err = app.writeJson(w, http.StatusCreated, envelope{"authentication_token": token}, nil)
+	err = app.models.LoginThrottles.Reset(data.ThrottleAccount, strconv.FormatInt(user.ID, 10))
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	family, err := data.GenerateFamily()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tokens, err := app.newSessionTokens(r, user, family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusCreated, tokens, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// recordFailedLogin counts a failed login against the client IP and, when the
+// email matched an account, against that account. The account owner is mailed
+// the moment their account gets locked.
+func (app *application) recordFailedLogin(ip string, user *data.User) error {
+
+	_, err := app.models.LoginThrottles.RecordFailure(data.ThrottleIP, ip, app.config.lockout.ip)
+	if err != nil {
+		return err
+	}
+
+	if user == nil {
+		return nil
+	}
+
+	throttle, err := app.models.LoginThrottles.RecordFailure(data.ThrottleAccount, strconv.FormatInt(user.ID, 10), app.config.lockout.account)
+	if err != nil {
+		return err
+	}
+
+	if throttle.Failures == app.config.lockout.account.Threshold {
+		app.logger.Warn("account locked after failed logins", "user_id", user.ID, "ip", ip)
+
+		app.background(func() {
+
+			data := map[string]any{
+				"failures":    throttle.Failures,
+				"lockedUntil": throttle.LockedUntil.Format(time.RFC1123),
+			}
+
+			err := app.mailer.Send(user.Email, "user_locked.tmpl", data)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		})
+	}
+
+	return nil
+}
+
+func (app *application) newSessionTokens(r *http.Request, user *data.User, family string) (envelope, error) {
+
+	accessToken, err := app.newAccessToken(r, user, family)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := app.models.Tokens.NewForSession(user.ID, app.config.tokens.refreshTTL, data.ScopeRefresh, family, app.clientIP(r), r.UserAgent())
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{"authentication_token": accessToken, "refresh_token": refreshToken}, nil
+}
+
+func (app *application) newAccessToken(r *http.Request, user *data.User, family string) (*data.Token, error) {
+
+	if !app.statelessTokens() {
+		return app.models.Tokens.NewForSession(user.ID, app.config.tokens.accessTTL, data.ScopeAuthentication, family, app.clientIP(r), r.UserAgent())
 	}
 
+	now := time.Now()
+	expiry := now.Add(app.config.tokens.accessTTL)
+
+	plaintext, err := app.keys.Sign(jwt.Claims{
+		Subject:   user.ID,
+		Issuer:    app.config.tokens.issuer,
+		Family:    family,
+		Activated: user.Activated,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expiry.Unix(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Token{Plaintext: plaintext, UserID: user.ID, Expiry: expiry, Scope: data.ScopeAuthentication, Family: family}, nil
+}
+
+func (app *application) refreshAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateTokenPlaintext(v, input.RefreshToken); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	token, err := app.models.Tokens.GetByPlaintext(data.ScopeRefresh, input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if token.UsedAt == nil {
+		err = app.models.Tokens.MarkUsed(token)
+	} else {
+		err = data.ErrEditConflict
+	}
+
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.logger.Warn("refresh token reuse detected, revoking token family", "user_id", token.UserID, "ip", app.clientIP(r))
+
+			err = app.revokeSessions(token.Family)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			err = app.models.Tokens.DeleteFamily(token.Family)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.models.Users.Get(token.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := app.newSessionTokens(r, user, token.Family)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusCreated, tokens, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) createPasswordResetTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "if an account exists for this email you will receive password reset instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeJson(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.sendPasswordResetEmail(user)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// sendPasswordResetEmail replaces any outstanding password reset token of the
+// user and mails them the new one.
+func (app *application) sendPasswordResetEmail(user *data.User) error {
+
+	err := app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		return err
+	}
+
+	token, err := app.models.Tokens.New(user.ID, 45*time.Minute, data.ScopePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	app.background(func() {
+
+		data := map[string]any{
+			"passwordResetToken": token.Plaintext,
+		}
+
+		err := app.mailer.Send(user.Email, "token_password_reset.tmpl", data)
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	return nil
+}
+
+func (app *application) createActivationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateEmail(v, input.Email); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	env := envelope{"message": "if an inactive account exists for this email you will receive activation instructions"}
+
+	user, err := app.models.Users.GetByEmail(input.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			err = app.writeJson(w, http.StatusAccepted, env, nil)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+			}
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !user.Activated {
+		err = app.models.Tokens.DeleteAllForUser(data.ScopeActivation, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeActivation)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+
+		app.background(func() {
+
+			data := map[string]any{
+				"userID":          token.UserID,
+				"activationToken": token.Plaintext,
+			}
+
+			err := app.mailer.Send(user.Email, "user_welcome.tmpl", data)
+			if err != nil {
+				app.logger.Error(err.Error())
+			}
+		})
+	}
+
+	err = app.writeJson(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	if family := app.contextGetFamily(r); family != "" {
+		err = app.revokeSessions(family)
+		if err == nil {
+			err = app.models.Tokens.DeleteFamily(family)
+		}
+	} else {
+		err = app.models.Tokens.DeleteSessionForToken(app.contextGetToken(r))
+	}
+
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "you have been logged out"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteAllAuthenticationTokensHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+
+	err := app.revokeAllSessions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "you have been logged out of all sessions"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) listSessionsHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+
+	sessions, err := app.models.Tokens.GetAllSessionsForUser(user.ID, app.contextGetToken(r), app.contextGetFamily(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+
+	user := app.contextGetUser(r)
+
+	sessionID := app.readStringParam(r, "id")
+
+	err := app.models.Tokens.DeleteSession(user.ID, sessionID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.revokeSessions(sessionID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "session successfully revoked"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
 }
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"errors"
+	"greenlight/internal/data"
+	"greenlight/internal/totp"
+	"greenlight/internal/validator"
+	"net/http"
+	"time"
+)
+
+const totpIssuer = "Greenlight"
+
+// verifyTOTPCode checks a code against the user's confirmed secret, allowing
+// one step of clock drift either way and rejecting codes that were already
+// used.
+func (app *application) verifyTOTPCode(userID int64, code string) (bool, error) {
+
+	enrolment, err := app.models.TOTP.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	step, ok := totp.Validate(enrolment.Secret, code, time.Now(), 1)
+	if !ok {
+		return false, nil
+	}
+
+	err = app.models.TOTP.UseStep(userID, step)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (app *application) createTOTPEnrolmentHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TOTP.Enrol(user.ID, secret)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrTOTPAlreadyEnabled):
+			app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	env := envelope{
+		"totp": envelope{
+			"secret": totp.EncodeSecret(secret),
+			"uri":    totp.URI(totpIssuer, user.Email, secret),
+		},
+	}
+
+	err = app.writeJson(w, http.StatusCreated, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmTOTPEnrolmentHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	enrolment, err := app.models.TOTP.Get(user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if enrolment.Confirmed {
+		app.errorResponse(w, r, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	valid, err := app.verifyTOTPCode(user.ID, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !valid {
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recoveryCodes, err := data.GenerateRecoveryCodes(10)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TOTP.Confirm(user.ID, recoveryCodes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateTOTPCode(v, input.Code); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	enabled, err := app.models.TOTP.Enabled(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !enabled {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	valid, err := app.verifyTOTPCode(user.ID, input.Code)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !valid {
+		v.AddError("code", "invalid code")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	recoveryCodes, err := data.GenerateRecoveryCodes(10)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.TOTP.ReplaceRecoveryCodes(user.ID, recoveryCodes)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"recovery_codes": recoveryCodes}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteTOTPEnrolmentHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidatePlaintextPassword(v, input.Password); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	match, err := user.Password.Match(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		app.invalidCredentialsResponse(w, r)
+		return
+	}
+
+	err = app.models.TOTP.Delete(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "two-factor authentication disabled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
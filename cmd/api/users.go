@@ -5,15 +5,18 @@ import (
 	"greenlight/internal/data"
 	"greenlight/internal/validator"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 )
 
 func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	var input struct {
-		Name     string `json:"name"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Name            string `json:"name"`
+		Email           string `json:"email"`
+		Password        string `json:"password"`
+		InvitationToken string `json:"invitation_token"`
 	}
 
 	err := app.readJson(w, r, &input)
@@ -41,6 +44,63 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	var invitation *data.Invitation
+
+	if app.config.users.inviteOnly || input.InvitationToken != "" {
+		invitation, err = app.models.Invitations.GetForToken(input.InvitationToken)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("invitation_token", "a valid invitation is required to register")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		if !strings.EqualFold(invitation.Email, user.Email) {
+			v.AddError("email", "must match the address the invitation was sent to")
+			app.failedValidationResponse(w, r, v.Errors)
+			return
+		}
+
+		// The invitation was delivered to this address, which proves
+		// ownership as well as an activation token would.
+		user.Activated = true
+	}
+
+	organizationID, err := app.defaultOrganizationID()
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if invitation != nil {
+		codes := append(slices.Clone(app.config.users.defaultPermissions), invitation.Permissions...)
+
+		err = app.models.Invitations.Redeem(invitation, user, codes, organizationID)
+		if err != nil {
+			switch {
+			case errors.Is(err, data.ErrDuplicateEmail):
+				v.AddError("email", "Email already in use")
+				app.failedValidationResponse(w, r, v.Errors)
+			case errors.Is(err, data.ErrRecordNotFound):
+				v.AddError("invitation_token", "a valid invitation is required to register")
+				app.failedValidationResponse(w, r, v.Errors)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+
+		err = app.writeJson(w, http.StatusOK, envelope{"user": user}, nil)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
 	err = app.models.Users.Insert(user)
 	if err != nil {
 		switch {
@@ -53,10 +113,20 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.ID, "movies:read")
-	if err != nil {
-		app.serverErrorResponse(w, r, err)
-		return
+	if len(app.config.users.defaultPermissions) > 0 {
+		err = app.models.Permissions.AddForUser(user.ID, app.config.users.defaultPermissions...)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if organizationID != 0 {
+		err = app.models.Organizations.AddMember(organizationID, user.ID)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
 	}
 
 	token, err := app.models.Tokens.New(user.ID, 24*time.Hour, data.ScopeActivation)
@@ -141,3 +211,625 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 		app.serverErrorResponse(w, r, err)
 	}
 }
+
+func (app *application) updateUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password       string `json:"password"`
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	data.ValidatePlaintextPassword(v, input.Password)
+	data.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.GetForToken(data.ScopePasswordReset, input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired password reset token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = user.Password.Set(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.revokeAllSessions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllScopesForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "your password was successfully reset"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) showCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	permissions, err := app.permissionsForRequest(r)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"user": user, "permissions": permissions}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	var input struct {
+		Name    *string `json:"name"`
+		Version *int    `json:"version"`
+	}
+
+	err = app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	v.Check(input.Version != nil, "version", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if *input.Version != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	if input.Name != nil {
+		user.Name = *input.Name
+	}
+
+	if data.ValidateUser(v, user); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) updateCurrentUserPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+		Version         *int   `json:"version"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	v.Check(input.CurrentPassword != "", "current_password", "must be provided")
+	data.ValidatePlaintextPassword(v, input.NewPassword)
+	v.Check(input.Version != nil, "version", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if *input.Version != user.Version {
+		app.editConflictResponse(w, r)
+		return
+	}
+
+	match, err := user.Password.Match(input.CurrentPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("current_password", "does not match your current password")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = user.Password.Set(input.NewPassword)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopePasswordReset, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	// As with a password reset, sessions opened with the old password must
+	// not outlive it, including the one making this request.
+	err = app.revokeAllSessions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) requestEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	data.ValidateEmail(v, input.Email)
+	v.Check(input.Password != "", "password", "must be provided")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Match(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("password", "does not match your current password")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	_, err = app.models.Users.GetByEmail(input.Email)
+	switch {
+	case err == nil:
+		v.AddError("email", "Email already in use")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	case !errors.Is(err, data.ErrRecordNotFound):
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.EmailChanges.New(user.ID, input.Email, 24*time.Hour)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.background(func() {
+
+		err := app.mailer.Send(input.Email, "token_email_change.tmpl", map[string]any{
+			"emailChangeToken": token.Plaintext,
+		})
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+
+		err = app.mailer.Send(user.Email, "user_email_change_notice.tmpl", map[string]any{
+			"newEmail": input.Email,
+		})
+		if err != nil {
+			app.logger.Error(err.Error())
+		}
+	})
+
+	err = app.writeJson(w, http.StatusAccepted, envelope{"message": "a confirmation email has been sent to the new address"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) confirmEmailChangeHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if data.ValidateTokenPlaintext(v, input.TokenPlaintext); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, newEmail, err := app.models.EmailChanges.GetForToken(input.TokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired token")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user.Email = newEmail
+
+	err = app.models.Users.Update(user)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "Email already in use")
+			app.failedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllForUser(data.ScopeEmailChange, user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"user": user}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) deleteCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Password string `json:"password"`
+	}
+
+	err := app.readJson(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.NewValidator()
+
+	if v.Check(input.Password != "", "password", "must be provided"); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.Get(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	match, err := user.Password.Match(input.Password)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !match {
+		v.AddError("password", "does not match your current password")
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	deleteAt := time.Now().Add(app.config.users.deletionGracePeriod)
+
+	err = app.models.Users.ScheduleDeletion(user.ID, deleteAt)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.revokeAllSessions(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Tokens.DeleteAllScopesForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	err = app.models.APIKeys.DeleteAllForUser(user.ID)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	env := envelope{
+		"message":               "your account is scheduled for deletion, log in and cancel the deletion before then to keep it",
+		"deletion_scheduled_at": deleteAt,
+	}
+
+	err = app.writeJson(w, http.StatusAccepted, env, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) cancelCurrentUserDeletionHandler(w http.ResponseWriter, r *http.Request) {
+
+	err := app.models.Users.CancelDeletion(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = app.writeJson(w, http.StatusOK, envelope{"message": "your account deletion has been cancelled"}, nil)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+func (app *application) exportCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+
+	export, err := app.exportUserData(app.contextGetUser(r).ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.invalidAuthenticationTokenResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Content-Disposition", `attachment; filename="greenlight-export.json"`)
+
+	err = app.writeJson(w, http.StatusOK, export, headers)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// defaultOrganizationID returns the ID of the organization newly registered
+// users join, or 0 if there is none.
+func (app *application) defaultOrganizationID() (int64, error) {
+	if app.config.users.defaultOrganization == "" {
+		return 0, nil
+	}
+
+	org, err := app.models.Organizations.GetBySlug(app.config.users.defaultOrganization)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			app.logger.Warn("default organization does not exist", "slug", app.config.users.defaultOrganization)
+			return 0, nil
+		default:
+			return 0, err
+		}
+	}
+
+	return org.ID, nil
+}
+
+// exportUserData gathers everything stored about a user for a data access
+// request.
+func (app *application) exportUserData(userID int64) (envelope, error) {
+
+	user, err := app.models.Users.Get(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	deletionScheduledAt, err := app.models.Users.GetDeletionSchedule(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := app.models.Permissions.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := app.models.Tokens.GetAllSessionsForUser(userID, "", "")
+	if err != nil {
+		return nil, err
+	}
+
+	apiKeys, err := app.models.APIKeys.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	mfaEnabled, err := app.models.TOTP.Enabled(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	movies, err := app.models.Movies.GetAllForCreator(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs, err := app.models.Organizations.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	reviews, err := app.models.Reviews.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	watchlist, err := app.models.Collections.GetAllForUser(userID, data.CollectionWatchlist)
+	if err != nil {
+		return nil, err
+	}
+
+	watched, err := app.models.Collections.GetAllForUser(userID, data.CollectionWatched)
+	if err != nil {
+		return nil, err
+	}
+
+	lists, err := app.models.Lists.GetAllForOwner(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return envelope{
+		"exported_at":           time.Now(),
+		"user":                  user,
+		"deletion_scheduled_at": deletionScheduledAt,
+		"permissions":           permissions,
+		"sessions":              sessions,
+		"api_keys":              apiKeys,
+		"two_factor_enabled":    mfaEnabled,
+		"movies":                movies,
+		"organizations":         orgs,
+		"reviews":               reviews,
+		"watchlist":             watchlist,
+		"watched":               watched,
+		"lists":                 lists,
+	}, nil
+}
+
+// purgeDeletedUsers periodically hard deletes accounts whose deletion grace
+// period has run out.
+func (app *application) purgeDeletedUsers() {
+	for {
+		deleted, err := app.models.Users.DeleteScheduled()
+		if err != nil {
+			app.logger.Error(err.Error())
+		} else if deleted > 0 {
+			app.logger.Info("deleted user accounts", "count", deleted)
+		}
+
+		time.Sleep(time.Hour)
+	}
+}
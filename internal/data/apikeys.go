@@ -0,0 +1,340 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"greenlight/internal/validator"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const APIKeyPrefix = "gl_"
+
+var ErrDuplicateAPIKeyName = errors.New("duplicate api key name")
+
+type APIKey struct {
+	ID          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UserID      int64           `json:"-"`
+	Name        string          `json:"name"`
+	Prefix      string          `json:"prefix"`
+	Plaintext   string          `json:"key,omitempty"`
+	Hash        []byte          `json:"-"`
+	Expiry      *time.Time      `json:"expiry"`
+	LastUsedAt  *time.Time      `json:"last_used_at"`
+	Permissions PermissionsList `json:"permissions"`
+	Version     int32           `json:"version"`
+}
+
+func GenerateAPIKey(userID int64, name string, expiry *time.Time, permissions PermissionsList) (*APIKey, error) {
+	key := &APIKey{
+		UserID:      userID,
+		Name:        name,
+		Expiry:      expiry,
+		Permissions: permissions,
+	}
+
+	randBytes := make([]byte, 32)
+
+	_, err := rand.Read(randBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	key.Plaintext = APIKeyPrefix + base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randBytes)
+	key.Prefix = key.Plaintext[:len(APIKeyPrefix)+8]
+
+	hash := sha256.Sum256([]byte(key.Plaintext))
+	key.Hash = hash[:]
+
+	return key, nil
+}
+
+func ValidateAPIKeyPlaintext(v *validator.Validator, plaintext string) {
+	v.Check(strings.HasPrefix(plaintext, APIKeyPrefix), "key", "must be a valid api key")
+	v.Check(len(plaintext) == len(APIKeyPrefix)+52, "key", "length of api key must be 55")
+}
+
+func ValidateAPIKey(v *validator.Validator, key *APIKey) {
+	v.Check(key.Name != "", "name", "must be provided")
+	v.Check(len(key.Name) <= 100, "name", "must not be more than 100 bytes long")
+
+	if key.Expiry != nil {
+		v.Check(key.Expiry.After(time.Now()), "expiry", "must be in the future")
+	}
+
+	v.Check(len(key.Permissions) >= 1, "permissions", "must contain at least 1 permission")
+	v.Check(validator.Unique(key.Permissions), "permissions", "must not contain duplicate values")
+}
+
+type APIKeyModel struct {
+	DB *sql.DB
+}
+
+func (m APIKeyModel) Insert(key *APIKey) error {
+
+	stmt := `INSERT INTO api_keys (user_id, name, prefix, hash, expiry)
+			 VALUES ($1, $2, $3, $4, $5)
+			 RETURNING id, created_at, version`
+
+	args := []any{key.UserID, key.Name, key.Prefix, key.Hash, key.Expiry}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, stmt, args...).Scan(&key.ID, &key.CreatedAt, &key.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "api_keys_user_id_name_key"`:
+			return ErrDuplicateAPIKeyName
+		default:
+			return err
+		}
+	}
+
+	stmt = `INSERT INTO api_keys_permissions
+			SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+
+	_, err = tx.ExecContext(ctx, stmt, key.ID, pq.Array(key.Permissions))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m APIKeyModel) Get(id, userID int64) (*APIKey, error) {
+
+	stmt := `SELECT api_keys.id, api_keys.created_at, api_keys.user_id, api_keys.name, api_keys.prefix,
+				api_keys.expiry, api_keys.last_used_at, api_keys.version,
+				ARRAY(SELECT permissions.code
+					  FROM permissions
+					  INNER JOIN api_keys_permissions ON api_keys_permissions.permission_id = permissions.id
+					  WHERE api_keys_permissions.api_key_id = api_keys.id
+					  ORDER BY permissions.code)
+			 FROM api_keys
+			 WHERE api_keys.id = $1 AND api_keys.user_id = $2`
+
+	key := &APIKey{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, userID).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.UserID,
+		&key.Name,
+		&key.Prefix,
+		&key.Expiry,
+		&key.LastUsedAt,
+		&key.Version,
+		pq.Array(&key.Permissions),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+func (m APIKeyModel) GetAllForUser(userID int64) ([]*APIKey, error) {
+
+	stmt := `SELECT api_keys.id, api_keys.created_at, api_keys.user_id, api_keys.name, api_keys.prefix,
+				api_keys.expiry, api_keys.last_used_at, api_keys.version,
+				ARRAY(SELECT permissions.code
+					  FROM permissions
+					  INNER JOIN api_keys_permissions ON api_keys_permissions.permission_id = permissions.id
+					  WHERE api_keys_permissions.api_key_id = api_keys.id
+					  ORDER BY permissions.code)
+			 FROM api_keys
+			 WHERE api_keys.user_id = $1
+			 ORDER BY api_keys.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*APIKey{}
+
+	for rows.Next() {
+		var key APIKey
+
+		err := rows.Scan(
+			&key.ID,
+			&key.CreatedAt,
+			&key.UserID,
+			&key.Name,
+			&key.Prefix,
+			&key.Expiry,
+			&key.LastUsedAt,
+			&key.Version,
+			pq.Array(&key.Permissions),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, &key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// GetForPlaintext returns an unexpired API key together with the user owning
+// it.
+func (m APIKeyModel) GetForPlaintext(plaintext string) (*APIKey, *User, error) {
+
+	stmt := `SELECT api_keys.id, api_keys.created_at, api_keys.name, api_keys.prefix,
+				api_keys.expiry, api_keys.last_used_at, api_keys.version,
+				ARRAY(SELECT permissions.code
+					  FROM permissions
+					  INNER JOIN api_keys_permissions ON api_keys_permissions.permission_id = permissions.id
+					  WHERE api_keys_permissions.api_key_id = api_keys.id),
+				users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version
+			 FROM api_keys
+			 INNER JOIN users ON users.id = api_keys.user_id
+			 WHERE api_keys.hash = $1
+			 AND (api_keys.expiry IS NULL OR api_keys.expiry > $2)`
+
+	hash := sha256.Sum256([]byte(plaintext))
+
+	key := &APIKey{}
+	user := &User{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, hash[:], time.Now()).Scan(
+		&key.ID,
+		&key.CreatedAt,
+		&key.Name,
+		&key.Prefix,
+		&key.Expiry,
+		&key.LastUsedAt,
+		&key.Version,
+		pq.Array(&key.Permissions),
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil, ErrRecordNotFound
+		default:
+			return nil, nil, err
+		}
+	}
+
+	key.UserID = user.ID
+
+	return key, user, nil
+}
+
+func (m APIKeyModel) Update(key *APIKey) error {
+
+	stmt := `UPDATE api_keys
+			 SET name = $1, expiry = $2, version = version + 1
+			 WHERE id = $3 AND user_id = $4 AND version = $5
+			 RETURNING version`
+
+	args := []any{key.Name, key.Expiry, key.ID, key.UserID, key.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&key.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "api_keys_user_id_name_key"`:
+			return ErrDuplicateAPIKeyName
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m APIKeyModel) Touch(id int64) error {
+
+	stmt := `UPDATE api_keys
+			 SET last_used_at = NOW()
+			 WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, id)
+	return err
+}
+
+func (m APIKeyModel) Delete(id, userID int64) error {
+
+	stmt := `DELETE FROM api_keys
+			 WHERE id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m APIKeyModel) DeleteAllForUser(userID int64) error {
+
+	stmt := `DELETE FROM api_keys
+			 WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID)
+	return err
+}
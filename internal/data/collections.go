@@ -0,0 +1,283 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"greenlight/internal/validator"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// The personal collections a user can keep movies in.
+const (
+	CollectionWatchlist = "watchlist"
+	CollectionWatched   = "watched"
+)
+
+// CollectionEntry is a movie in one of a user's collections, ordered by
+// position.
+type CollectionEntry struct {
+	MovieID  int64     `json:"movie_id"`
+	Position int       `json:"position"`
+	Notes    string    `json:"notes"`
+	AddedAt  time.Time `json:"added_at"`
+	Movie    *Movie    `json:"movie,omitempty"`
+}
+
+func ValidateCollectionEntry(v *validator.Validator, entry *CollectionEntry) {
+	v.Check(entry.Position >= 0, "position", "must be a positive integer")
+	v.Check(len(entry.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+}
+
+type CollectionModel struct {
+	DB *sql.DB
+}
+
+// collectionScope is the positionScope of one of the user's collections.
+func collectionScope(userID int64, collection string) positionScope {
+	return positionScope{
+		table: "collection_entries",
+		where: "user_id = $1 AND collection = $2",
+		args:  []any{userID, collection},
+	}
+}
+
+// lockCollection serialises changes to the same collection for the rest of
+// the transaction, so positions stay contiguous.
+func lockCollection(ctx context.Context, tx *sql.Tx, userID int64, collection string) error {
+	_, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, userID, collection)
+	return err
+}
+
+// Put adds the movie to the collection, or updates its entry if it is already
+// there, moving it to the entry's position (see positionScope.place).
+func (m CollectionModel) Put(userID int64, collection string, entry *CollectionEntry) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockCollection(ctx, tx, userID, collection)
+	if err != nil {
+		return err
+	}
+
+	position, exists, err := collectionScope(userID, collection).place(ctx, tx, entry.MovieID, entry.Position)
+	if err != nil {
+		return err
+	}
+
+	entry.Position = position
+
+	var stmt string
+
+	if exists {
+		stmt = `UPDATE collection_entries
+				SET position = $4, notes = $5
+				WHERE user_id = $1 AND collection = $2 AND movie_id = $3
+				RETURNING created_at`
+	} else {
+		stmt = `INSERT INTO collection_entries (user_id, collection, movie_id, position, notes)
+				VALUES ($1, $2, $3, $4, $5)
+				RETURNING created_at`
+	}
+
+	err = tx.QueryRowContext(ctx, stmt, userID, collection, entry.MovieID, entry.Position, entry.Notes).Scan(&entry.AddedAt)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m CollectionModel) Get(userID int64, collection string, movieID int64) (*CollectionEntry, error) {
+
+	stmt := `SELECT movie_id, position, notes, created_at
+			 FROM collection_entries
+			 WHERE user_id = $1 AND collection = $2 AND movie_id = $3`
+
+	var entry CollectionEntry
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, userID, collection, movieID).Scan(
+		&entry.MovieID,
+		&entry.Position,
+		&entry.Notes,
+		&entry.AddedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &entry, nil
+}
+
+// GetAll returns the entries of the collection whose movies belong to the
+// organization, along with the movies themselves.
+func (m CollectionModel) GetAll(userID int64, collection string, organizationID int64, filters Filters) ([]*CollectionEntry, Metadata, error) {
+
+	stmt := fmt.Sprintf(`SELECT COUNT(*) OVER(), collection_entries.position AS position, collection_entries.notes,
+				collection_entries.created_at AS added_at,
+				movies.id, movies.created_at, movies.organization_id, movies.title, movies.year, movies.runtime, `+movieGenres+`,
+				movies.created_by, average_rating, rating_count, movies.version
+			 FROM collection_entries
+			 INNER JOIN movies ON movies.id = collection_entries.movie_id
+			 `+movieRatingsJoin+`
+			 WHERE collection_entries.user_id = $1 AND collection_entries.collection = $2 AND movies.organization_id = $3
+			 ORDER BY %s %s, movies.id ASC
+			 LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{userID, collection, organizationID, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	entries := []*CollectionEntry{}
+
+	for rows.Next() {
+		var (
+			entry CollectionEntry
+			movie Movie
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&entry.Position,
+			&entry.Notes,
+			&entry.AddedAt,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.OrganizationID,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.CreatedBy,
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entry.MovieID = movie.ID
+		entry.Movie = &movie
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+// GetAllForUser returns every entry of the collection, across organizations,
+// without the movies.
+func (m CollectionModel) GetAllForUser(userID int64, collection string) ([]*CollectionEntry, error) {
+
+	stmt := `SELECT movie_id, position, notes, created_at
+			 FROM collection_entries
+			 WHERE user_id = $1 AND collection = $2
+			 ORDER BY position`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID, collection)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*CollectionEntry{}
+
+	for rows.Next() {
+		var entry CollectionEntry
+
+		err := rows.Scan(
+			&entry.MovieID,
+			&entry.Position,
+			&entry.Notes,
+			&entry.AddedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Delete removes the movie from the collection and closes the gap it leaves.
+func (m CollectionModel) Delete(userID int64, collection string, movieID int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockCollection(ctx, tx, userID, collection)
+	if err != nil {
+		return err
+	}
+
+	stmt := `DELETE FROM collection_entries
+			 WHERE user_id = $1 AND collection = $2 AND movie_id = $3
+			 RETURNING position`
+
+	var position int
+
+	err = tx.QueryRowContext(ctx, stmt, userID, collection, movieID).Scan(&position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = collectionScope(userID, collection).close(ctx, tx, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
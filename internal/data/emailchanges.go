@@ -0,0 +1,109 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type EmailChangeModel struct {
+	DB *sql.DB
+}
+
+// New issues an email-change token for the user and records the address it
+// confirms. Earlier pending changes for the user are discarded.
+func (m EmailChangeModel) New(userID int64, newEmail string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `DELETE FROM tokens
+			 WHERE user_id = $1 AND scope = $2`
+
+	_, err = tx.ExecContext(ctx, stmt, userID, ScopeEmailChange)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt = `INSERT INTO tokens (hash, user_id, expiry, scope)
+			VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, stmt, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt = `INSERT INTO email_changes (hash, new_email)
+			VALUES ($1, $2)`
+
+	_, err = tx.ExecContext(ctx, stmt, token.Hash, newEmail)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// GetForToken returns the user owning a valid email-change token and the
+// address the token confirms.
+func (m EmailChangeModel) GetForToken(tokenPlaintext string) (*User, string, error) {
+
+	stmt := `SELECT users.id, users.created_at, users.name, users.email, users.password_hash, users.activated, users.version,
+				email_changes.new_email
+			 FROM users
+			 INNER JOIN tokens ON users.id = tokens.user_id
+			 INNER JOIN email_changes ON email_changes.hash = tokens.hash
+			 WHERE tokens.hash = $1
+			 AND tokens.scope = $2
+			 AND tokens.expiry > $3`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	args := []any{tokenHash[:], ScopeEmailChange, time.Now()}
+
+	var (
+		user     User
+		newEmail string
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+		&newEmail,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, "", ErrRecordNotFound
+		default:
+			return nil, "", err
+		}
+	}
+
+	return &user, newEmail, nil
+}
@@ -0,0 +1,73 @@
+package data
+
+import (
+	"sync"
+	"time"
+)
+
+// GenreCache keeps the genre taxonomy in memory, since every movie list,
+// create and update resolves genres against it. It is dropped whenever a
+// genre is written; the TTL bounds how stale another instance's copy can get.
+type GenreCache struct {
+	ttl time.Duration
+
+	mu     sync.RWMutex
+	lookup GenreLookup
+	expiry time.Time
+	// generation is bumped on every invalidation so that a load which raced
+	// with a genre write doesn't store what it read.
+	generation uint64
+}
+
+// NewGenreCache returns a cache holding the taxonomy for ttl. A zero ttl
+// disables caching.
+func NewGenreCache(ttl time.Duration) *GenreCache {
+	return &GenreCache{ttl: ttl}
+}
+
+// get returns the cached taxonomy, or on a miss the generation to pass to set
+// once it has been loaded. The returned lookup is shared and must not be
+// modified.
+func (c *GenreCache) get() (GenreLookup, uint64, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, 0, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.lookup == nil || time.Now().After(c.expiry) {
+		return nil, c.generation, false
+	}
+
+	return c.lookup, c.generation, true
+}
+
+func (c *GenreCache) set(generation uint64, lookup GenreLookup) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	c.lookup = lookup
+	c.expiry = time.Now().Add(c.ttl)
+}
+
+// Invalidate drops the cached taxonomy.
+func (c *GenreCache) Invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.lookup = nil
+}
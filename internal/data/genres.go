@@ -0,0 +1,369 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"greenlight/internal/validator"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateGenre = errors.New("duplicate genre")
+	ErrGenreInUse     = errors.New("genre in use")
+
+	GenreSlugRx = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+	genreSlugSeparatorRx = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+type Genre struct {
+	ID         int64     `json:"id"`
+	CreatedAt  time.Time `json:"-"`
+	Slug       string    `json:"slug"`
+	Name       string    `json:"name"`
+	Aliases    []string  `json:"aliases"`
+	MovieCount *int      `json:"movie_count,omitempty"`
+	Version    int32     `json:"version"`
+}
+
+// GenreSlug turns a free-text genre such as "Sci Fi" into the form used for
+// slugs and aliases ("sci-fi"). It matches the conversion applied to existing
+// movies when the taxonomy was introduced.
+func GenreSlug(name string) string {
+	return strings.Trim(genreSlugSeparatorRx.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+func ValidateGenre(v *validator.Validator, genre *Genre) {
+	v.Check(genre.Slug != "", "slug", "must be provided")
+	v.Check(len(genre.Slug) <= 50, "slug", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(genre.Slug, GenreSlugRx), "slug", "must only contain lowercase letters and digits separated by '-'")
+	v.Check(genre.Name != "", "name", "must be provided")
+	v.Check(len(genre.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(validator.Unique(genre.Aliases), "aliases", "must not contain duplicate values")
+
+	for _, alias := range genre.Aliases {
+		v.Check(validator.Matches(alias, GenreSlugRx), "aliases", "must only contain lowercase letters and digits separated by '-'")
+		v.Check(alias != genre.Slug, "aliases", "must not contain the genre's own slug")
+	}
+}
+
+// GenreLookup maps the slug and aliases of every genre to the genre's slug.
+type GenreLookup map[string]string
+
+// Canonical returns the genre slugs for the given free-text names. Names that
+// don't match any genre are returned as their slug, which Known rejects.
+func (l GenreLookup) Canonical(names []string) []string {
+	if names == nil {
+		return nil
+	}
+
+	slugs := make([]string, len(names))
+
+	for i, name := range names {
+		slug := GenreSlug(name)
+
+		if canonical, ok := l[slug]; ok {
+			slug = canonical
+		}
+
+		slugs[i] = slug
+	}
+
+	return slugs
+}
+
+// Known reports whether slug is the slug of a genre, as opposed to an alias
+// or an unknown value.
+func (l GenreLookup) Known(slug string) bool {
+	return l[slug] == slug && slug != ""
+}
+
+type GenreModel struct {
+	DB    *sql.DB
+	Cache *GenreCache
+}
+
+const genreColumns = `genres.id, genres.created_at, genres.slug, genres.name,
+				ARRAY(SELECT genre_aliases.alias
+					  FROM genre_aliases
+					  WHERE genre_aliases.genre_id = genres.id
+					  ORDER BY genre_aliases.alias),
+				genres.version`
+
+func (m GenreModel) Insert(genre *Genre) error {
+
+	stmt := `INSERT INTO genres (slug, name)
+			 VALUES ($1, $2)
+			 RETURNING id, created_at, version`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, stmt, genre.Slug, genre.Name).Scan(&genre.ID, &genre.CreatedAt, &genre.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	err = setGenreAliases(ctx, tx, genre)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate()
+
+	return nil
+}
+
+func (m GenreModel) Get(id int64) (*Genre, error) {
+
+	stmt := `SELECT ` + genreColumns + `
+			 FROM genres
+			 WHERE genres.id = $1`
+
+	var genre Genre
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(
+		&genre.ID,
+		&genre.CreatedAt,
+		&genre.Slug,
+		&genre.Name,
+		pq.Array(&genre.Aliases),
+		&genre.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &genre, nil
+}
+
+// GetAll returns every genre along with the number of the organization's
+// movies tagged with it.
+func (m GenreModel) GetAll(organizationID int64) ([]*Genre, error) {
+
+	stmt := `SELECT ` + genreColumns + `,
+				(SELECT COUNT(*)
+				 FROM movies_genres
+				 INNER JOIN movies ON movies.id = movies_genres.movie_id
+				 WHERE movies_genres.genre_id = genres.id AND movies.organization_id = $1)
+			 FROM genres
+			 ORDER BY genres.name`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, organizationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	genres := []*Genre{}
+
+	for rows.Next() {
+		var genre Genre
+		var movieCount int
+
+		err := rows.Scan(
+			&genre.ID,
+			&genre.CreatedAt,
+			&genre.Slug,
+			&genre.Name,
+			pq.Array(&genre.Aliases),
+			&genre.Version,
+			&movieCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		genre.MovieCount = &movieCount
+
+		genres = append(genres, &genre)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return genres, nil
+}
+
+// Lookup returns the whole taxonomy for resolving free-text genres. Slugs take
+// precedence over aliases of other genres. The lookup may be shared with other
+// callers and must not be modified.
+func (m GenreModel) Lookup() (GenreLookup, error) {
+
+	lookup, generation, ok := m.Cache.get()
+	if ok {
+		return lookup, nil
+	}
+
+	stmt := `SELECT genre_aliases.alias, genres.slug
+			 FROM genre_aliases
+			 INNER JOIN genres ON genres.id = genre_aliases.genre_id
+			 UNION ALL
+			 SELECT genres.slug, genres.slug
+			 FROM genres`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lookup = GenreLookup{}
+
+	for rows.Next() {
+		var key, slug string
+
+		err := rows.Scan(&key, &slug)
+		if err != nil {
+			return nil, err
+		}
+
+		if lookup[key] != key {
+			lookup[key] = slug
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	m.Cache.set(generation, lookup)
+
+	return lookup, nil
+}
+
+func (m GenreModel) Update(genre *Genre) error {
+
+	stmt := `UPDATE genres
+			 SET slug = $1, name = $2, version = version + 1
+			 WHERE id = $3 AND version = $4
+			 RETURNING version`
+
+	args := []any{genre.Slug, genre.Name, genre.ID, genre.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, stmt, args...).Scan(&genre.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		case err.Error() == `pq: duplicate key value violates unique constraint "genres_slug_key"`:
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	err = setGenreAliases(ctx, tx, genre)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate()
+
+	return nil
+}
+
+func setGenreAliases(ctx context.Context, tx *sql.Tx, genre *Genre) error {
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM genre_aliases WHERE genre_id = $1`, genre.ID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO genre_aliases (alias, genre_id)
+			 SELECT unnest($1::text[]), $2`
+
+	_, err = tx.ExecContext(ctx, stmt, pq.Array(genre.Aliases), genre.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "genre_aliases_pkey"`:
+			return ErrDuplicateGenre
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m GenreModel) Delete(id int64) error {
+
+	stmt := `DELETE FROM genres
+			 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: update or delete on table "genres" violates foreign key constraint "movies_genres_genre_id_fkey" on table "movies_genres"`:
+			return ErrGenreInUse
+		default:
+			return err
+		}
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	m.Cache.Invalidate()
+
+	return nil
+}
@@ -0,0 +1,165 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Invitation lets the holder of its token register the invited address while
+// registration is closed. The token belongs to the user who sent it.
+type Invitation struct {
+	Hash        []byte          `json:"-"`
+	InvitedBy   int64           `json:"invited_by"`
+	Email       string          `json:"email"`
+	Permissions PermissionsList `json:"permissions"`
+	Expiry      time.Time       `json:"expiry"`
+}
+
+type InvitationModel struct {
+	DB *sql.DB
+}
+
+// New issues an invitation token for the email address, replacing any earlier
+// invitation sent to it.
+func (m InvitationModel) New(invitation *Invitation, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(invitation.InvitedBy, ttl, ScopeInvitation)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `DELETE FROM tokens
+			 USING invitations
+			 WHERE tokens.hash = invitations.hash AND invitations.email = $1`
+
+	_, err = tx.ExecContext(ctx, stmt, invitation.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt = `INSERT INTO tokens (hash, user_id, expiry, scope)
+			VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, stmt, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt = `INSERT INTO invitations (hash, email, permissions)
+			VALUES ($1, $2, $3)`
+
+	_, err = tx.ExecContext(ctx, stmt, token.Hash, invitation.Email, pq.Array(invitation.Permissions))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	invitation.Hash = token.Hash
+	invitation.Expiry = token.Expiry
+
+	return token, nil
+}
+
+// GetForToken returns the invitation behind a valid invitation token.
+func (m InvitationModel) GetForToken(tokenPlaintext string) (*Invitation, error) {
+
+	stmt := `SELECT tokens.hash, tokens.user_id, invitations.email, invitations.permissions, tokens.expiry
+			 FROM tokens
+			 INNER JOIN invitations ON invitations.hash = tokens.hash
+			 WHERE tokens.hash = $1
+			 AND tokens.scope = $2
+			 AND tokens.expiry > $3`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	args := []any{tokenHash[:], ScopeInvitation, time.Now()}
+
+	var invitation Invitation
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(
+		&invitation.Hash,
+		&invitation.InvitedBy,
+		&invitation.Email,
+		pq.Array(&invitation.Permissions),
+		&invitation.Expiry,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &invitation, nil
+}
+
+// Redeem registers the invited user in one go: it creates the user, grants
+// them the codes, adds them to the organization unless it is 0, and uses up
+// the invitation. Nothing is kept if any step fails. ErrRecordNotFound means
+// the invitation was redeemed in the meantime.
+func (m InvitationModel) Redeem(invitation *Invitation, user *User, codes []string, organizationID int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx, `DELETE FROM tokens WHERE hash = $1`, invitation.Hash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	err = insertUser(ctx, tx, user)
+	if err != nil {
+		return err
+	}
+
+	err = addUserPermissions(ctx, tx, user.ID, codes)
+	if err != nil {
+		return err
+	}
+
+	if organizationID != 0 {
+		err = addMember(ctx, tx, organizationID, user.ID, nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,642 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"greenlight/internal/validator"
+	"slices"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Private lists are only seen by their owner and collaborators, unlisted ones
+// by anyone with the link, and public ones are also browsable.
+const (
+	ListPrivate  = "private"
+	ListUnlisted = "unlisted"
+	ListPublic   = "public"
+)
+
+var (
+	ErrDuplicateCollaborator = errors.New("duplicate collaborator")
+	ErrInvalidOrder          = errors.New("invalid order")
+)
+
+type List struct {
+	ID             int64     `json:"id"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+	OrganizationID int64     `json:"organization_id"`
+	OwnerID        int64     `json:"owner_id"`
+	Title          string    `json:"title"`
+	Description    string    `json:"description"`
+	Visibility     string    `json:"visibility"`
+	ItemCount      int       `json:"item_count"`
+	Version        int32     `json:"version"`
+}
+
+// ListItem is a movie on a list, ordered by position.
+type ListItem struct {
+	MovieID  int64     `json:"movie_id"`
+	Position int       `json:"position"`
+	Notes    string    `json:"notes"`
+	AddedBy  *int64    `json:"added_by"`
+	AddedAt  time.Time `json:"added_at"`
+	Movie    *Movie    `json:"movie,omitempty"`
+}
+
+type ListCollaborator struct {
+	UserID  int64     `json:"user_id"`
+	Name    string    `json:"name"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+func ValidateList(v *validator.Validator, list *List) {
+	v.Check(list.Title != "", "title", "must be provided")
+	v.Check(len(list.Title) <= 200, "title", "must not be more than 200 bytes long")
+	v.Check(len(list.Description) <= 2000, "description", "must not be more than 2000 bytes long")
+	v.Check(validator.PermittedValue(list.Visibility, ListPrivate, ListUnlisted, ListPublic), "visibility", "must be private, unlisted or public")
+}
+
+func ValidateListItem(v *validator.Validator, item *ListItem) {
+	v.Check(item.Position >= 0, "position", "must be a positive integer")
+	v.Check(len(item.Notes) <= 1000, "notes", "must not be more than 1000 bytes long")
+}
+
+type ListModel struct {
+	DB *sql.DB
+}
+
+const listColumns = `lists.id, lists.created_at, lists.updated_at, lists.organization_id, lists.owner_id,
+				lists.title, lists.description, lists.visibility,
+				(SELECT COUNT(*) FROM lists_movies WHERE lists_movies.list_id = lists.id),
+				lists.version`
+
+func (m ListModel) Insert(list *List) error {
+
+	stmt := `INSERT INTO lists (organization_id, owner_id, title, description, visibility)
+			 VALUES ($1, $2, $3, $4, $5)
+			 RETURNING id, created_at, updated_at, version`
+
+	args := []any{list.OrganizationID, list.OwnerID, list.Title, list.Description, list.Visibility}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, stmt, args...).Scan(&list.ID, &list.CreatedAt, &list.UpdatedAt, &list.Version)
+}
+
+func (m ListModel) Get(organizationID, id int64) (*List, error) {
+
+	stmt := `SELECT ` + listColumns + `
+			 FROM lists
+			 WHERE lists.id = $1 AND lists.organization_id = $2`
+
+	var list List
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, organizationID).Scan(
+		&list.ID,
+		&list.CreatedAt,
+		&list.UpdatedAt,
+		&list.OrganizationID,
+		&list.OwnerID,
+		&list.Title,
+		&list.Description,
+		&list.Visibility,
+		&list.ItemCount,
+		&list.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &list, nil
+}
+
+// GetAllVisible returns the organization's public lists together with the
+// lists the user owns or collaborates on. With mine set, only the latter.
+func (m ListModel) GetAllVisible(organizationID, userID int64, mine bool, filters Filters) ([]*List, Metadata, error) {
+
+	stmt := fmt.Sprintf(`SELECT COUNT(*) OVER(), `+listColumns+`
+			 FROM lists
+			 WHERE lists.organization_id = $1
+			 AND ((lists.visibility = 'public' AND NOT $2)
+				OR lists.owner_id = $3
+				OR EXISTS (SELECT 1 FROM lists_collaborators WHERE lists_collaborators.list_id = lists.id AND lists_collaborators.user_id = $3))
+			 ORDER BY lists.%s %s, lists.id ASC
+			 LIMIT $4 OFFSET $5`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{organizationID, mine, userID, filters.limit(), filters.offset()}
+
+	return m.query(stmt, filters, args...)
+}
+
+// GetAllForOwner returns every list the user owns, across organizations.
+func (m ListModel) GetAllForOwner(userID int64) ([]*List, error) {
+
+	stmt := `SELECT ` + listColumns + `
+			 FROM lists
+			 WHERE lists.owner_id = $1
+			 ORDER BY lists.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []*List{}
+
+	for rows.Next() {
+		var list List
+
+		err := rows.Scan(
+			&list.ID,
+			&list.CreatedAt,
+			&list.UpdatedAt,
+			&list.OrganizationID,
+			&list.OwnerID,
+			&list.Title,
+			&list.Description,
+			&list.Visibility,
+			&list.ItemCount,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (m ListModel) query(stmt string, filters Filters, args ...any) ([]*List, Metadata, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	lists := []*List{}
+
+	for rows.Next() {
+		var list List
+
+		err := rows.Scan(
+			&totalRecords,
+			&list.ID,
+			&list.CreatedAt,
+			&list.UpdatedAt,
+			&list.OrganizationID,
+			&list.OwnerID,
+			&list.Title,
+			&list.Description,
+			&list.Visibility,
+			&list.ItemCount,
+			&list.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		lists = append(lists, &list)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return lists, metadata, nil
+}
+
+func (m ListModel) Update(list *List) error {
+
+	stmt := `UPDATE lists
+			 SET title = $1, description = $2, visibility = $3, updated_at = NOW(), version = version + 1
+			 WHERE id = $4 AND version = $5
+			 RETURNING updated_at, version`
+
+	args := []any{list.Title, list.Description, list.Visibility, list.ID, list.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&list.UpdatedAt, &list.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ListModel) Delete(id int64) error {
+
+	stmt := `DELETE FROM lists
+			 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// lockList takes a row lock on the list for the rest of the transaction, so
+// that concurrent item changes don't leave gaps in the positions, and marks
+// the list as updated.
+func lockList(ctx context.Context, tx *sql.Tx, listID int64) error {
+
+	stmt := `UPDATE lists
+			 SET updated_at = NOW()
+			 WHERE id = $1`
+
+	_, err := tx.ExecContext(ctx, stmt, listID)
+	return err
+}
+
+// listScope is the positionScope of the list's items.
+func listScope(listID int64) positionScope {
+	return positionScope{
+		table: "lists_movies",
+		where: "list_id = $1",
+		args:  []any{listID},
+	}
+}
+
+func (m ListModel) GetItems(listID int64, filters Filters) ([]*ListItem, Metadata, error) {
+
+	stmt := fmt.Sprintf(`SELECT COUNT(*) OVER(), lists_movies.position AS position, lists_movies.notes, lists_movies.added_by,
+				lists_movies.created_at AS added_at,
+				movies.id, movies.created_at, movies.organization_id, movies.title, movies.year, movies.runtime, `+movieGenres+`,
+				movies.created_by, average_rating, rating_count, movies.version
+			 FROM lists_movies
+			 INNER JOIN movies ON movies.id = lists_movies.movie_id
+			 `+movieRatingsJoin+`
+			 WHERE lists_movies.list_id = $1
+			 ORDER BY %s %s, movies.id ASC
+			 LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, listID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	items := []*ListItem{}
+
+	for rows.Next() {
+		var (
+			item  ListItem
+			movie Movie
+		)
+
+		err := rows.Scan(
+			&totalRecords,
+			&item.Position,
+			&item.Notes,
+			&item.AddedBy,
+			&item.AddedAt,
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.OrganizationID,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.CreatedBy,
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		item.MovieID = movie.ID
+		item.Movie = &movie
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return items, metadata, nil
+}
+
+func (m ListModel) GetItem(listID, movieID int64) (*ListItem, error) {
+
+	stmt := `SELECT movie_id, position, notes, added_by, created_at
+			 FROM lists_movies
+			 WHERE list_id = $1 AND movie_id = $2`
+
+	var item ListItem
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, listID, movieID).Scan(
+		&item.MovieID,
+		&item.Position,
+		&item.Notes,
+		&item.AddedBy,
+		&item.AddedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &item, nil
+}
+
+// PutItem adds the movie to the list, or updates its item if it is already
+// there, moving it to the item's position (see positionScope.place).
+func (m ListModel) PutItem(listID int64, item *ListItem) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockList(ctx, tx, listID)
+	if err != nil {
+		return err
+	}
+
+	position, exists, err := listScope(listID).place(ctx, tx, item.MovieID, item.Position)
+	if err != nil {
+		return err
+	}
+
+	item.Position = position
+
+	if exists {
+		stmt := `UPDATE lists_movies
+				 SET position = $3, notes = $4
+				 WHERE list_id = $1 AND movie_id = $2
+				 RETURNING added_by, created_at`
+
+		err = tx.QueryRowContext(ctx, stmt, listID, item.MovieID, item.Position, item.Notes).Scan(&item.AddedBy, &item.AddedAt)
+	} else {
+		stmt := `INSERT INTO lists_movies (list_id, movie_id, added_by, position, notes)
+				 VALUES ($1, $2, $3, $4, $5)
+				 RETURNING created_at`
+
+		err = tx.QueryRowContext(ctx, stmt, listID, item.MovieID, item.AddedBy, item.Position, item.Notes).Scan(&item.AddedAt)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteItem removes the movie from the list and closes the gap it leaves.
+func (m ListModel) DeleteItem(listID, movieID int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockList(ctx, tx, listID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `DELETE FROM lists_movies
+			 WHERE list_id = $1 AND movie_id = $2
+			 RETURNING position`
+
+	var position int
+
+	err = tx.QueryRowContext(ctx, stmt, listID, movieID).Scan(&position)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	err = listScope(listID).close(ctx, tx, position)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Reorder puts the list's movies in the given order. The movie IDs must be
+// exactly the movies currently on the list, or ErrInvalidOrder is returned.
+func (m ListModel) Reorder(listID int64, movieIDs []int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = lockList(ctx, tx, listID)
+	if err != nil {
+		return err
+	}
+
+	var current []int64
+
+	err = tx.QueryRowContext(ctx, `SELECT ARRAY(SELECT movie_id FROM lists_movies WHERE list_id = $1 ORDER BY movie_id)`, listID).Scan(pq.Array(&current))
+	if err != nil {
+		return err
+	}
+
+	sorted := slices.Clone(movieIDs)
+	slices.Sort(sorted)
+
+	if !slices.Equal(sorted, current) {
+		return ErrInvalidOrder
+	}
+
+	stmt := `UPDATE lists_movies
+			 SET position = ordered.position
+			 FROM unnest($2::bigint[]) WITH ORDINALITY AS ordered(movie_id, position)
+			 WHERE lists_movies.list_id = $1 AND lists_movies.movie_id = ordered.movie_id`
+
+	_, err = tx.ExecContext(ctx, stmt, listID, pq.Array(movieIDs))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// IsCollaborator reports whether the user may edit the items of the list
+// without owning it.
+func (m ListModel) IsCollaborator(listID, userID int64) (bool, error) {
+
+	stmt := `SELECT EXISTS (SELECT 1 FROM lists_collaborators WHERE list_id = $1 AND user_id = $2)`
+
+	var exists bool
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, listID, userID).Scan(&exists)
+	return exists, err
+}
+
+func (m ListModel) GetCollaborators(listID int64) ([]*ListCollaborator, error) {
+
+	stmt := `SELECT users.id, users.name, lists_collaborators.created_at
+			 FROM lists_collaborators
+			 INNER JOIN users ON users.id = lists_collaborators.user_id
+			 WHERE lists_collaborators.list_id = $1
+			 ORDER BY lists_collaborators.created_at, users.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, listID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	collaborators := []*ListCollaborator{}
+
+	for rows.Next() {
+		var collaborator ListCollaborator
+
+		err := rows.Scan(&collaborator.UserID, &collaborator.Name, &collaborator.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		collaborators = append(collaborators, &collaborator)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return collaborators, nil
+}
+
+func (m ListModel) AddCollaborator(listID, userID int64) error {
+
+	stmt := `INSERT INTO lists_collaborators (list_id, user_id)
+			 VALUES ($1, $2)
+			 ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, listID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrDuplicateCollaborator
+	}
+
+	return nil
+}
+
+func (m ListModel) RemoveCollaborator(listID, userID int64) error {
+
+	stmt := `DELETE FROM lists_collaborators
+			 WHERE list_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, listID, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
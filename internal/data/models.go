@@ -1,8 +1,10 @@
 package data
 
 import (
+	"context"
 	"database/sql"
 	"errors"
+	"time"
 )
 
 var (
@@ -10,14 +12,37 @@ var (
 	ErrEditConflict   = errors.New("edit conflict")
 )
 
+// queryer is implemented by both *sql.DB and *sql.Tx, so that a statement
+// can be shared between a standalone method and a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Models struct {
-	Movies      MovieModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Movies         MovieModel
+	Users          UserModel
+	Tokens         TokenModel
+	Permissions    PermissionModel
+	Revocations    RevocationModel
+	APIKeys        APIKeyModel
+	LoginThrottles LoginThrottleModel
+	TOTP           TOTPModel
+	EmailChanges   EmailChangeModel
+	Roles          RoleModel
+	Organizations  OrganizationModel
+	Invitations    InvitationModel
+	Reviews        ReviewModel
+	Collections    CollectionModel
+	Lists          ListModel
+	People         PersonModel
+	Credits        CreditModel
+	Genres         GenreModel
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *sql.DB, permissionCacheTTL, genreCacheTTL time.Duration) Models {
+	permissionCache := NewPermissionCache(permissionCacheTTL)
+
 	return Models{
 		Movies: MovieModel{
 			DB: db,
@@ -29,7 +54,53 @@ func NewModels(db *sql.DB) Models {
 			DB: db,
 		},
 		Permissions: PermissionModel{
+			DB:    db,
+			Cache: permissionCache,
+		},
+		Revocations: RevocationModel{
+			DB: db,
+		},
+		APIKeys: APIKeyModel{
+			DB: db,
+		},
+		LoginThrottles: LoginThrottleModel{
+			DB: db,
+		},
+		TOTP: TOTPModel{
 			DB: db,
 		},
+		EmailChanges: EmailChangeModel{
+			DB: db,
+		},
+		Roles: RoleModel{
+			DB:    db,
+			Cache: permissionCache,
+		},
+		Organizations: OrganizationModel{
+			DB:    db,
+			Cache: permissionCache,
+		},
+		Invitations: InvitationModel{
+			DB: db,
+		},
+		Reviews: ReviewModel{
+			DB: db,
+		},
+		Collections: CollectionModel{
+			DB: db,
+		},
+		Lists: ListModel{
+			DB: db,
+		},
+		People: PersonModel{
+			DB: db,
+		},
+		Credits: CreditModel{
+			DB: db,
+		},
+		Genres: GenreModel{
+			DB:    db,
+			Cache: NewGenreCache(genreCacheTTL),
+		},
 	}
 }
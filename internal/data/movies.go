@@ -12,16 +12,23 @@ import (
 )
 
 type Movie struct {
-	ID        int64     `json:"id"`
-	CreatedAt time.Time `json:"-"`
-	Title     string    `json:"title"`
-	Year      int32     `json:"year,omitempty"`
-	Runtime   Runtime   `json:"runtime,omitempty,string"`
-	Genres    []string  `json:"genres,omitempty"`
-	Version   int32     `json:"version"`
+	ID             int64     `json:"id"`
+	CreatedAt      time.Time `json:"-"`
+	OrganizationID int64     `json:"organization_id"`
+	Title          string    `json:"title"`
+	Year           int32     `json:"year,omitempty"`
+	Runtime        Runtime   `json:"runtime,omitempty,string"`
+	Genres         []string  `json:"genres,omitempty"`
+	CreatedBy      *int64    `json:"created_by"`
+	AverageRating  float64   `json:"average_rating"`
+	RatingCount    int       `json:"rating_count"`
+	Credits        []*Credit `json:"credits,omitempty"`
+	Version        int32     `json:"version"`
 }
 
-func ValidateMovie(v *validator.Validator, movie *Movie) {
+// ValidateMovie checks the movie's genres against the taxonomy in genres, so
+// they should already have been through genres.Canonical.
+func ValidateMovie(v *validator.Validator, movie *Movie, genres GenreLookup) {
 	v.Check(movie.Title != "", "title", "must be provided")
 	v.Check(len(movie.Title) <= 500, "title", "must not be more than 500 bytes long")
 	v.Check(movie.Year != 0, "year", "must be provided")
@@ -33,38 +40,75 @@ func ValidateMovie(v *validator.Validator, movie *Movie) {
 	v.Check(len(movie.Genres) >= 1, "genres", "must contain at least 1 genre")
 	v.Check(len(movie.Genres) <= 5, "genres", "must not contain more than 5 genres")
 	v.Check(validator.Unique(movie.Genres), "genres", "must not contain duplicate values")
+
+	for _, genre := range movie.Genres {
+		v.Check(genres.Known(genre), "genres", fmt.Sprintf("%q is not a known genre", genre))
+	}
 }
 
 type MovieModel struct {
 	DB *sql.DB
 }
 
+// movieRatingsJoin adds the average_rating and rating_count of each movie's
+// reviews to a query on movies.
+const movieRatingsJoin = `LEFT JOIN LATERAL (
+					SELECT COALESCE(ROUND(AVG(reviews.rating), 2), 0)::float8 AS average_rating, COUNT(*) AS rating_count
+					FROM reviews
+					WHERE reviews.movie_id = movies.id
+				) AS ratings ON true`
+
+// movieGenres selects the slugs of a movie's genres in the order they were
+// given.
+const movieGenres = `ARRAY(SELECT genres.slug
+					FROM movies_genres
+					INNER JOIN genres ON genres.id = movies_genres.genre_id
+					WHERE movies_genres.movie_id = movies.id
+					ORDER BY movies_genres.position)`
+
 func (m MovieModel) Insert(movie *Movie) error {
 
-	stmnt := `	insert into movies (title,year,runtime,genres)
-			 	values ($1,$2,$3,$4)
+	stmnt := `	insert into movies (organization_id,title,year,runtime,created_by)
+			 	values ($1,$2,$3,$4,$5)
 				returning id,created_at,version`
 
-	args := []any{movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres)}
+	args := []any{movie.OrganizationID, movie.Title, movie.Year, movie.Runtime, movie.CreatedBy}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	return m.DB.QueryRowContext(ctx, stmnt, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, stmnt, args...).Scan(&movie.ID, &movie.CreatedAt, &movie.Version)
+	if err != nil {
+		return err
+	}
+
+	err = setMovieGenres(ctx, tx, movie.ID, movie.Genres)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 
 }
 
-func (m MovieModel) Get(id int64) (*Movie, error) {
-	stmt := `	select id,created_at,title,year,runtime,genres,version
+func (m MovieModel) Get(organizationID, id int64) (*Movie, error) {
+	stmt := `	select id,created_at,organization_id,title,year,runtime,` + movieGenres + `,created_by,average_rating,rating_count,version
 				from movies
-				where id=$1`
+				` + movieRatingsJoin + `
+				where id=$1 and organization_id=$2`
 
 	movie := new(Movie)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&movie.ID, &movie.CreatedAt, &movie.Title, &movie.Year, &movie.Runtime, pq.Array(&movie.Genres), &movie.Version)
+	err := m.DB.QueryRowContext(ctx, stmt, id, organizationID).Scan(&movie.ID, &movie.CreatedAt, &movie.OrganizationID, &movie.Title, &movie.Year, &movie.Runtime, pq.Array(&movie.Genres), &movie.CreatedBy, &movie.AverageRating, &movie.RatingCount, &movie.Version)
 
 	if err != nil {
 
@@ -79,14 +123,20 @@ func (m MovieModel) Get(id int64) (*Movie, error) {
 func (m MovieModel) Update(movie *Movie) error {
 
 	stmt := `	update movies
-				set title=$1,year = $2, runtime = $3, genres = $4, version = version + 1
-				where id=$5 and version=$6
+				set title=$1,year = $2, runtime = $3, version = version + 1
+				where id=$4 and version=$5 and organization_id=$6
 				returning version`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	err := m.DB.QueryRowContext(ctx, stmt, movie.Title, movie.Year, movie.Runtime, pq.Array(movie.Genres), movie.ID, movie.Version).Scan(&movie.Version)
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, stmt, movie.Title, movie.Year, movie.Runtime, movie.ID, movie.Version, movie.OrganizationID).Scan(&movie.Version)
 
 	if err != nil {
 		switch {
@@ -98,21 +148,44 @@ func (m MovieModel) Update(movie *Movie) error {
 		}
 	}
 
-	return nil
+	err = setMovieGenres(ctx, tx, movie.ID, movie.Genres)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
-func (m MovieModel) Delete(id int64) error {
+// setMovieGenres replaces the movie's genres with the given slugs, keeping
+// their order.
+func setMovieGenres(ctx context.Context, tx *sql.Tx, movieID int64, slugs []string) error {
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM movies_genres WHERE movie_id = $1`, movieID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO movies_genres (movie_id, genre_id, position)
+			 SELECT $1, genres.id, given.position
+			 FROM unnest($2::text[]) WITH ORDINALITY AS given (slug, position)
+			 INNER JOIN genres ON genres.slug = given.slug`
+
+	_, err = tx.ExecContext(ctx, stmt, movieID, pq.Array(slugs))
+	return err
+}
+
+func (m MovieModel) Delete(organizationID, id int64) error {
 	if id < 1 {
 		return ErrRecordNotFound
 	}
 
 	stmnt := `	delete from movies 
-				where id=$1`
+				where id=$1 and organization_id=$2`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	res, err := m.DB.ExecContext(ctx, stmnt, id)
+	res, err := m.DB.ExecContext(ctx, stmnt, id, organizationID)
 
 	if err != nil {
 		return err
@@ -130,22 +203,57 @@ func (m MovieModel) Delete(id int64) error {
 	return nil
 }
 
-func (m MovieModel) GetAll(title string, genres []string, filter Filters) ([]*Movie, Metadata, error) {
+// MovieQuery holds the search criteria for MovieModel.GetAll. OnWatchlist
+// and Watched are ignored when nil, and otherwise refer to the collections of
+// UserID. Director and Actor are person IDs, ignored when 0.
+type MovieQuery struct {
+	OrganizationID int64
+	Title          string
+	Genres         []string
+	UserID         int64
+	OnWatchlist    *bool
+	Watched        *bool
+	Director       int64
+	Actor          int64
+}
+
+func (m MovieModel) GetAll(query MovieQuery, filter Filters) ([]*Movie, Metadata, error) {
 
 	var list []*Movie
 
 	stmt := fmt.Sprintf(`
-         SELECT COUNT(*) OVER(),id, created_at, title, year, runtime, genres, version
+         SELECT COUNT(*) OVER(),id, created_at, organization_id, title, year, runtime, `+movieGenres+`, created_by, average_rating, rating_count, version
         FROM movies
-        WHERE (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '') 
-        AND (genres @> $2 OR $2 = '{}')     
+        `+movieRatingsJoin+`
+        WHERE organization_id = $5
+        AND (to_tsvector('simple', title) @@ plainto_tsquery('simple', $1) OR $1 = '') 
+        AND NOT EXISTS (
+            SELECT 1 FROM unnest($2::text[]) AS wanted (slug)
+            WHERE NOT EXISTS (
+                SELECT 1 FROM movies_genres
+                INNER JOIN genres ON genres.id = movies_genres.genre_id
+                WHERE movies_genres.movie_id = movies.id AND genres.slug = wanted.slug))
+        AND ($7::boolean IS NULL OR EXISTS (
+            SELECT 1 FROM collection_entries
+            WHERE collection_entries.user_id = $6 AND collection_entries.movie_id = movies.id AND collection_entries.collection = 'watchlist') = $7)
+        AND ($8::boolean IS NULL OR EXISTS (
+            SELECT 1 FROM collection_entries
+            WHERE collection_entries.user_id = $6 AND collection_entries.movie_id = movies.id AND collection_entries.collection = 'watched') = $8)
+        AND ($9::bigint = 0 OR EXISTS (
+            SELECT 1 FROM credits
+            WHERE credits.movie_id = movies.id AND credits.person_id = $9 AND credits.role = 'director'))
+        AND ($10::bigint = 0 OR EXISTS (
+            SELECT 1 FROM credits
+            WHERE credits.movie_id = movies.id AND credits.person_id = $10 AND credits.role = 'actor'))
         ORDER BY %s %s, id ASC
         LIMIT $3 OFFSET $4`, filter.sortColumn(), filter.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, stmt, title, pq.Array(genres), filter.limit(), filter.offset())
+	args := []any{query.Title, pq.Array(query.Genres), filter.limit(), filter.offset(), query.OrganizationID, query.UserID, query.OnWatchlist, query.Watched, query.Director, query.Actor}
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
 
 	if err != nil {
 		return nil, Metadata{}, err
@@ -163,10 +271,14 @@ func (m MovieModel) GetAll(title string, genres []string, filter Filters) ([]*Mo
 			&totalRecords,
 			&movie.ID,
 			&movie.CreatedAt,
+			&movie.OrganizationID,
 			&movie.Title,
 			&movie.Year,
 			&movie.Runtime,
 			pq.Array(&movie.Genres),
+			&movie.CreatedBy,
+			&movie.AverageRating,
+			&movie.RatingCount,
 			&movie.Version,
 		)
 
@@ -185,3 +297,54 @@ func (m MovieModel) GetAll(title string, genres []string, filter Filters) ([]*Mo
 
 	return list, metadata, nil
 }
+
+// GetAllForCreator returns the movies added by the given user.
+func (m MovieModel) GetAllForCreator(userID int64) ([]*Movie, error) {
+
+	stmt := `	SELECT id, created_at, organization_id, title, year, runtime, ` + movieGenres + `, created_by, average_rating, rating_count, version
+				FROM movies
+				` + movieRatingsJoin + `
+				WHERE created_by = $1
+				ORDER BY id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movies := []*Movie{}
+
+	for rows.Next() {
+
+		var movie Movie
+
+		err := rows.Scan(
+			&movie.ID,
+			&movie.CreatedAt,
+			&movie.OrganizationID,
+			&movie.Title,
+			&movie.Year,
+			&movie.Runtime,
+			pq.Array(&movie.Genres),
+			&movie.CreatedBy,
+			&movie.AverageRating,
+			&movie.RatingCount,
+			&movie.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		movies = append(movies, &movie)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return movies, nil
+}
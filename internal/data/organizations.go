@@ -0,0 +1,478 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"greenlight/internal/validator"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateSlug   = errors.New("duplicate slug")
+	ErrAlreadyMember   = errors.New("already a member")
+	OrganizationSlugRx = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+)
+
+type Organization struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+}
+
+// Member is a user's membership of an organization, along with the
+// permissions granted to them there on top of their global ones.
+type Member struct {
+	UserID      int64           `json:"user_id"`
+	Name        string          `json:"name"`
+	Email       string          `json:"email"`
+	JoinedAt    time.Time       `json:"joined_at"`
+	Permissions PermissionsList `json:"permissions"`
+}
+
+func ValidateOrganization(v *validator.Validator, org *Organization) {
+	v.Check(org.Name != "", "name", "must be provided")
+	v.Check(len(org.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(org.Slug != "", "slug", "must be provided")
+	v.Check(len(org.Slug) <= 100, "slug", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(org.Slug, OrganizationSlugRx), "slug", "must only contain lowercase letters, digits and single hyphens")
+}
+
+type OrganizationModel struct {
+	DB    *sql.DB
+	Cache *PermissionCache
+}
+
+// Insert creates the organization with the owner as its first member, granted
+// the given permissions within it.
+func (m OrganizationModel) Insert(org *Organization, ownerID int64, ownerPermissions ...string) error {
+
+	stmt := `INSERT INTO organizations (name, slug)
+			 VALUES ($1, $2)
+			 RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, stmt, org.Name, org.Slug).Scan(&org.ID, &org.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "organizations_slug_key"`:
+			return ErrDuplicateSlug
+		default:
+			return err
+		}
+	}
+
+	err = addMember(ctx, tx, org.ID, ownerID, ownerPermissions)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(ownerID)
+
+	return nil
+}
+
+func (m OrganizationModel) Get(id int64) (*Organization, error) {
+
+	stmt := `SELECT id, created_at, name, slug
+			 FROM organizations
+			 WHERE id = $1`
+
+	return m.queryOne(stmt, id)
+}
+
+func (m OrganizationModel) GetBySlug(slug string) (*Organization, error) {
+
+	stmt := `SELECT id, created_at, name, slug
+			 FROM organizations
+			 WHERE slug = $1`
+
+	return m.queryOne(stmt, slug)
+}
+
+// GetForMember returns the organization only if the user belongs to it.
+func (m OrganizationModel) GetForMember(id, userID int64) (*Organization, error) {
+
+	stmt := `SELECT organizations.id, organizations.created_at, organizations.name, organizations.slug
+			 FROM organizations
+			 INNER JOIN organizations_users ON organizations_users.organization_id = organizations.id
+			 WHERE organizations.id = $1 AND organizations_users.user_id = $2`
+
+	return m.queryOne(stmt, id, userID)
+}
+
+// GetDefaultForMember returns the organization the user joined first, used
+// when a request doesn't name one.
+func (m OrganizationModel) GetDefaultForMember(userID int64) (*Organization, error) {
+
+	stmt := `SELECT organizations.id, organizations.created_at, organizations.name, organizations.slug
+			 FROM organizations
+			 INNER JOIN organizations_users ON organizations_users.organization_id = organizations.id
+			 WHERE organizations_users.user_id = $1
+			 ORDER BY organizations_users.created_at, organizations.id
+			 LIMIT 1`
+
+	return m.queryOne(stmt, userID)
+}
+
+func (m OrganizationModel) queryOne(stmt string, args ...any) (*Organization, error) {
+
+	var org Organization
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(
+		&org.ID,
+		&org.CreatedAt,
+		&org.Name,
+		&org.Slug,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &org, nil
+}
+
+func (m OrganizationModel) GetAll() ([]*Organization, error) {
+
+	stmt := `SELECT id, created_at, name, slug
+			 FROM organizations
+			 ORDER BY name, id`
+
+	return m.query(stmt)
+}
+
+func (m OrganizationModel) GetAllForUser(userID int64) ([]*Organization, error) {
+
+	stmt := `SELECT organizations.id, organizations.created_at, organizations.name, organizations.slug
+			 FROM organizations
+			 INNER JOIN organizations_users ON organizations_users.organization_id = organizations.id
+			 WHERE organizations_users.user_id = $1
+			 ORDER BY organizations_users.created_at, organizations.id`
+
+	return m.query(stmt, userID)
+}
+
+func (m OrganizationModel) query(stmt string, args ...any) ([]*Organization, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orgs := []*Organization{}
+
+	for rows.Next() {
+		var org Organization
+
+		err := rows.Scan(
+			&org.ID,
+			&org.CreatedAt,
+			&org.Name,
+			&org.Slug,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		orgs = append(orgs, &org)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+// AddMember adds the user to the organization with the given permissions.
+func (m OrganizationModel) AddMember(id, userID int64, codes ...string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = addMember(ctx, tx, id, userID, codes)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userID)
+
+	return nil
+}
+
+// Invite issues a token with which the user can accept joining the
+// organization with the given permissions, replacing any earlier invitation
+// to it. The token belongs to the invited user.
+func (m OrganizationModel) Invite(id, invitedBy, userID int64, codes []string, ttl time.Duration) (*Token, error) {
+	token, err := generateToken(userID, ttl, ScopeOrgInvitation)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := `DELETE FROM tokens
+			 USING organization_invitations
+			 WHERE tokens.hash = organization_invitations.hash
+			 AND organization_invitations.organization_id = $1 AND tokens.user_id = $2`
+
+	_, err = tx.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt = `INSERT INTO tokens (hash, user_id, expiry, scope)
+			VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, stmt, token.Hash, token.UserID, token.Expiry, token.Scope)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt = `INSERT INTO organization_invitations (hash, organization_id, invited_by, permissions)
+			VALUES ($1, $2, $3, $4)`
+
+	_, err = tx.ExecContext(ctx, stmt, token.Hash, id, invitedBy, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// AcceptInvitation makes the user a member of the organization that sent them
+// the invitation token, and uses the token up. It returns the organization's
+// ID, or ErrRecordNotFound if the token isn't a valid invitation for the user.
+func (m OrganizationModel) AcceptInvitation(userID int64, tokenPlaintext string) (int64, error) {
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `DELETE FROM tokens
+			 USING organization_invitations
+			 WHERE tokens.hash = organization_invitations.hash
+			 AND tokens.hash = $1 AND tokens.scope = $2 AND tokens.user_id = $3 AND tokens.expiry > $4
+			 RETURNING organization_invitations.organization_id, organization_invitations.permissions`
+
+	var id int64
+	var codes []string
+
+	err = tx.QueryRowContext(ctx, stmt, tokenHash[:], ScopeOrgInvitation, userID, time.Now()).Scan(&id, pq.Array(&codes))
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrRecordNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	err = addMember(ctx, tx, id, userID, codes)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+
+	m.Cache.Invalidate(userID)
+
+	return id, nil
+}
+
+func addMember(ctx context.Context, tx *sql.Tx, id, userID int64, codes []string) error {
+
+	stmt := `INSERT INTO organizations_users (organization_id, user_id)
+			 VALUES ($1, $2)
+			 ON CONFLICT DO NOTHING`
+
+	res, err := tx.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrAlreadyMember
+	}
+
+	return setMemberPermissions(ctx, tx, id, userID, codes)
+}
+
+const memberColumns = `users.id, users.name, users.email, organizations_users.created_at,
+				ARRAY(SELECT permissions.code
+					  FROM permissions
+					  INNER JOIN organizations_users_permissions ON organizations_users_permissions.permission_id = permissions.id
+					  WHERE organizations_users_permissions.organization_id = organizations_users.organization_id
+					  AND organizations_users_permissions.user_id = organizations_users.user_id
+					  ORDER BY permissions.code)`
+
+func (m OrganizationModel) GetMember(id, userID int64) (*Member, error) {
+
+	stmt := `SELECT ` + memberColumns + `
+			 FROM organizations_users
+			 INNER JOIN users ON users.id = organizations_users.user_id
+			 WHERE organizations_users.organization_id = $1 AND organizations_users.user_id = $2`
+
+	var member Member
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, userID).Scan(
+		&member.UserID,
+		&member.Name,
+		&member.Email,
+		&member.JoinedAt,
+		pq.Array(&member.Permissions),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &member, nil
+}
+
+func (m OrganizationModel) GetAllMembers(id int64) ([]*Member, error) {
+
+	stmt := `SELECT ` + memberColumns + `
+			 FROM organizations_users
+			 INNER JOIN users ON users.id = organizations_users.user_id
+			 WHERE organizations_users.organization_id = $1
+			 ORDER BY organizations_users.created_at, users.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Member{}
+
+	for rows.Next() {
+		var member Member
+
+		err := rows.Scan(
+			&member.UserID,
+			&member.Name,
+			&member.Email,
+			&member.JoinedAt,
+			pq.Array(&member.Permissions),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// RemoveMember takes the user out of the organization, along with the
+// permissions they held there.
+func (m OrganizationModel) RemoveMember(id, userID int64) error {
+
+	stmt := `DELETE FROM organizations_users
+			 WHERE organization_id = $1 AND user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	m.Cache.Invalidate(userID)
+
+	return nil
+}
@@ -0,0 +1,398 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"greenlight/internal/validator"
+	"time"
+)
+
+// The roles a person can be credited with on a movie.
+const (
+	CreditDirector = "director"
+	CreditWriter   = "writer"
+	CreditActor    = "actor"
+	CreditProducer = "producer"
+	CreditComposer = "composer"
+)
+
+var ErrDuplicateCredit = errors.New("duplicate credit")
+
+type Person struct {
+	ID             int64     `json:"id"`
+	CreatedAt      time.Time `json:"-"`
+	OrganizationID int64     `json:"organization_id"`
+	Name           string    `json:"name"`
+	BirthYear      *int32    `json:"birth_year"`
+	Bio            string    `json:"bio"`
+	Version        int32     `json:"version"`
+}
+
+// Credit links a person to a movie in a role. Character is only meaningful
+// for actors, and a lower billing order is listed first.
+type Credit struct {
+	ID           int64  `json:"id"`
+	MovieID      int64  `json:"movie_id"`
+	MovieTitle   string `json:"movie_title"`
+	PersonID     int64  `json:"person_id"`
+	PersonName   string `json:"person_name"`
+	Role         string `json:"role"`
+	Character    string `json:"character,omitempty"`
+	BillingOrder int    `json:"billing_order"`
+}
+
+func ValidatePerson(v *validator.Validator, person *Person) {
+	v.Check(person.Name != "", "name", "must be provided")
+	v.Check(len(person.Name) <= 200, "name", "must not be more than 200 bytes long")
+	v.Check(len(person.Bio) <= 5000, "bio", "must not be more than 5000 bytes long")
+
+	if person.BirthYear != nil {
+		v.Check(*person.BirthYear >= 1800, "birth_year", "must be greater than 1800")
+		v.Check(*person.BirthYear <= int32(time.Now().Year()), "birth_year", "must not be in the future")
+	}
+}
+
+func ValidateCredit(v *validator.Validator, credit *Credit) {
+	v.Check(credit.PersonID > 0, "person_id", "must be provided")
+	v.Check(validator.PermittedValue(credit.Role, CreditDirector, CreditWriter, CreditActor, CreditProducer, CreditComposer), "role", "must be director, writer, actor, producer or composer")
+	v.Check(len(credit.Character) <= 200, "character", "must not be more than 200 bytes long")
+	v.Check(credit.Character == "" || credit.Role == CreditActor, "character", "must only be set for actors")
+	v.Check(credit.BillingOrder >= 0, "billing_order", "must not be negative")
+}
+
+type PersonModel struct {
+	DB *sql.DB
+}
+
+func (m PersonModel) Insert(person *Person) error {
+
+	stmt := `INSERT INTO people (organization_id, name, birth_year, bio)
+			 VALUES ($1, $2, $3, $4)
+			 RETURNING id, created_at, version`
+
+	args := []any{person.OrganizationID, person.Name, person.BirthYear, person.Bio}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return m.DB.QueryRowContext(ctx, stmt, args...).Scan(&person.ID, &person.CreatedAt, &person.Version)
+}
+
+func (m PersonModel) Get(organizationID, id int64) (*Person, error) {
+
+	stmt := `SELECT id, created_at, organization_id, name, birth_year, bio, version
+			 FROM people
+			 WHERE id = $1 AND organization_id = $2`
+
+	var person Person
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, organizationID).Scan(
+		&person.ID,
+		&person.CreatedAt,
+		&person.OrganizationID,
+		&person.Name,
+		&person.BirthYear,
+		&person.Bio,
+		&person.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &person, nil
+}
+
+func (m PersonModel) GetAll(organizationID int64, name string, filters Filters) ([]*Person, Metadata, error) {
+
+	stmt := fmt.Sprintf(`SELECT COUNT(*) OVER(), id, created_at, organization_id, name, birth_year, bio, version
+			 FROM people
+			 WHERE organization_id = $1
+			 AND (to_tsvector('simple', name) @@ plainto_tsquery('simple', $2) OR $2 = '')
+			 ORDER BY %s %s, id ASC
+			 LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	args := []any{organizationID, name, filters.limit(), filters.offset()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	people := []*Person{}
+
+	for rows.Next() {
+		var person Person
+
+		err := rows.Scan(
+			&totalRecords,
+			&person.ID,
+			&person.CreatedAt,
+			&person.OrganizationID,
+			&person.Name,
+			&person.BirthYear,
+			&person.Bio,
+			&person.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		people = append(people, &person)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return people, metadata, nil
+}
+
+func (m PersonModel) Update(person *Person) error {
+
+	stmt := `UPDATE people
+			 SET name = $1, birth_year = $2, bio = $3, version = version + 1
+			 WHERE id = $4 AND version = $5 AND organization_id = $6
+			 RETURNING version`
+
+	args := []any{person.Name, person.BirthYear, person.Bio, person.ID, person.Version, person.OrganizationID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&person.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m PersonModel) Delete(organizationID, id int64) error {
+
+	stmt := `DELETE FROM people
+			 WHERE id = $1 AND organization_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, id, organizationID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+type CreditModel struct {
+	DB *sql.DB
+}
+
+const creditColumns = `credits.id, credits.movie_id, movies.title, credits.person_id, people.name,
+				credits.role, credits.character, credits.billing_order`
+
+func (m CreditModel) Insert(credit *Credit) error {
+
+	stmt := `INSERT INTO credits (movie_id, person_id, role, character, billing_order)
+			 VALUES ($1, $2, $3, $4, $5)
+			 RETURNING id`
+
+	args := []any{credit.MovieID, credit.PersonID, credit.Role, credit.Character, credit.BillingOrder}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&credit.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "credits_movie_id_person_id_role_character_key"`:
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m CreditModel) Get(movieID, id int64) (*Credit, error) {
+
+	stmt := `SELECT ` + creditColumns + `
+			 FROM credits
+			 INNER JOIN movies ON movies.id = credits.movie_id
+			 INNER JOIN people ON people.id = credits.person_id
+			 WHERE credits.id = $1 AND credits.movie_id = $2`
+
+	var credit Credit
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, movieID).Scan(
+		&credit.ID,
+		&credit.MovieID,
+		&credit.MovieTitle,
+		&credit.PersonID,
+		&credit.PersonName,
+		&credit.Role,
+		&credit.Character,
+		&credit.BillingOrder,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &credit, nil
+}
+
+// GetAllForMovie returns the movie's credits, directors and writers first and
+// each role in billing order.
+func (m CreditModel) GetAllForMovie(movieID int64) ([]*Credit, error) {
+
+	stmt := `SELECT ` + creditColumns + `
+			 FROM credits
+			 INNER JOIN movies ON movies.id = credits.movie_id
+			 INNER JOIN people ON people.id = credits.person_id
+			 WHERE credits.movie_id = $1
+			 ORDER BY array_position(ARRAY['director', 'writer', 'actor', 'producer', 'composer'], credits.role),
+				credits.billing_order, credits.id`
+
+	return m.query(stmt, movieID)
+}
+
+// GetAllForPerson returns the person's filmography, newest movies first.
+func (m CreditModel) GetAllForPerson(personID int64) ([]*Credit, error) {
+
+	stmt := `SELECT ` + creditColumns + `
+			 FROM credits
+			 INNER JOIN movies ON movies.id = credits.movie_id
+			 INNER JOIN people ON people.id = credits.person_id
+			 WHERE credits.person_id = $1
+			 ORDER BY movies.year DESC, movies.id, credits.id`
+
+	return m.query(stmt, personID)
+}
+
+func (m CreditModel) query(stmt string, args ...any) ([]*Credit, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	credits := []*Credit{}
+
+	for rows.Next() {
+		var credit Credit
+
+		err := rows.Scan(
+			&credit.ID,
+			&credit.MovieID,
+			&credit.MovieTitle,
+			&credit.PersonID,
+			&credit.PersonName,
+			&credit.Role,
+			&credit.Character,
+			&credit.BillingOrder,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		credits = append(credits, &credit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return credits, nil
+}
+
+func (m CreditModel) Update(credit *Credit) error {
+
+	stmt := `UPDATE credits
+			 SET role = $1, character = $2, billing_order = $3
+			 WHERE id = $4`
+
+	args := []any{credit.Role, credit.Character, credit.BillingOrder, credit.ID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "credits_movie_id_person_id_role_character_key"`:
+			return ErrDuplicateCredit
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m CreditModel) Delete(id int64) error {
+
+	stmt := `DELETE FROM credits
+			 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
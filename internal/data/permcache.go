@@ -0,0 +1,149 @@
+package data
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PermissionCache keeps each user's effective permissions, globally and
+// within each organization, in memory for a short while, so that
+// requirePermissionsMiddleware doesn't hit the database on every request.
+// Entries are dropped whenever the grants behind them change; the TTL bounds
+// how stale another instance's cache can get.
+type PermissionCache struct {
+	ttl time.Duration
+
+	mu      sync.RWMutex
+	entries map[permissionCacheKey]permissionCacheEntry
+	// generation is bumped on every invalidation so that a lookup which
+	// raced with a grant change doesn't store what it read.
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// permissionCacheKey identifies a user's permissions within an organization,
+// or their global permissions when organizationID is 0.
+type permissionCacheKey struct {
+	userID         int64
+	organizationID int64
+}
+
+type permissionCacheEntry struct {
+	permissions PermissionsList
+	expiry      time.Time
+}
+
+type PermissionCacheStats struct {
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Entries int   `json:"entries"`
+}
+
+// NewPermissionCache returns a cache holding entries for ttl. A zero ttl
+// disables caching.
+func NewPermissionCache(ttl time.Duration) *PermissionCache {
+	return &PermissionCache{
+		ttl:     ttl,
+		entries: make(map[permissionCacheKey]permissionCacheEntry),
+	}
+}
+
+// get returns the cached permissions for the user, or on a miss the
+// generation to pass to set once they have been loaded.
+func (c *PermissionCache) get(key permissionCacheKey) (PermissionsList, uint64, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, 0, false
+	}
+
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	generation := c.generation
+	c.mu.RUnlock()
+
+	if !ok || time.Now().After(entry.expiry) {
+		c.misses.Add(1)
+		return nil, generation, false
+	}
+
+	c.hits.Add(1)
+	return slices.Clone(entry.permissions), generation, true
+}
+
+func (c *PermissionCache) set(key permissionCacheKey, generation uint64, permissions PermissionsList) {
+	if c == nil || c.ttl <= 0 {
+		return
+	}
+
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	for k, entry := range c.entries {
+		if now.After(entry.expiry) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = permissionCacheEntry{
+		permissions: slices.Clone(permissions),
+		expiry:      now.Add(c.ttl),
+	}
+}
+
+// Invalidate drops the cached permissions of the given users, in every
+// organization.
+func (c *PermissionCache) Invalidate(userIDs ...int64) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	for key := range c.entries {
+		if slices.Contains(userIDs, key.userID) {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// InvalidateAll empties the cache, for changes such as editing a role that
+// may affect any number of users.
+func (c *PermissionCache) InvalidateAll() {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+
+	clear(c.entries)
+}
+
+func (c *PermissionCache) Stats() PermissionCacheStats {
+	if c == nil {
+		return PermissionCacheStats{}
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return PermissionCacheStats{
+		Hits:    c.hits.Load(),
+		Misses:  c.misses.Load(),
+		Entries: len(c.entries),
+	}
+}
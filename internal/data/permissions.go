@@ -3,28 +3,129 @@ package data
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"greenlight/internal/validator"
+	"regexp"
 	"slices"
+	"strings"
 	"time"
 
 	"github.com/lib/pq"
 )
 
+var (
+	ErrDuplicatePermission = errors.New("duplicate permission")
+
+	PermissionCodeRx = regexp.MustCompile(`^([a-z0-9_-]+|\*)(:([a-z0-9_-]+|\*))+$`)
+)
+
+type Permission struct {
+	ID   int64  `json:"id"`
+	Code string `json:"code"`
+}
+
+func ValidatePermissionCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) <= 100, "code", "must not be more than 100 bytes long")
+	v.Check(validator.Matches(code, PermissionCodeRx), "code", "must look like resource:action, optionally using * for a segment")
+}
+
 type PermissionsList []string
 
-func (p PermissionsList) Includes(permission string) bool {
-	return slices.Contains(p, permission)
+// Includes reports whether any of the permissions in p grants the given
+// code. Granted permissions may use "*" for a whole segment: "*:read" grants
+// "movies:read", and a trailing "*" grants any number of remaining segments,
+// so "movies:*" grants both "movies:write" and "movies:write:any".
+func (p PermissionsList) Includes(code string) bool {
+	for _, permission := range p {
+		if permissionMatches(permission, code) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IncludesAny reports whether at least one of the codes is granted by p.
+func (p PermissionsList) IncludesAny(codes ...string) bool {
+	return slices.ContainsFunc(codes, p.Includes)
+}
+
+// IncludesAll reports whether every one of the codes is granted by p.
+func (p PermissionsList) IncludesAll(codes ...string) bool {
+	for _, code := range codes {
+		if !p.Includes(code) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func permissionMatches(pattern, code string) bool {
+	patternSegments := strings.Split(pattern, ":")
+	codeSegments := strings.Split(code, ":")
+
+	for i, segment := range patternSegments {
+		if i >= len(codeSegments) {
+			return false
+		}
+
+		if segment == "*" && i == len(patternSegments)-1 {
+			return true
+		}
+
+		if segment != "*" && segment != codeSegments[i] {
+			return false
+		}
+	}
+
+	return len(patternSegments) == len(codeSegments)
+}
+
+// Restrict returns the permissions granted by both p and allowed. Either side
+// may use patterns, so the result keeps the narrower of each matching pair.
+func (p PermissionsList) Restrict(allowed PermissionsList) PermissionsList {
+	var restricted PermissionsList
+
+	for _, permission := range p {
+		if allowed.Includes(permission) && !slices.Contains(restricted, permission) {
+			restricted = append(restricted, permission)
+		}
+	}
+
+	for _, permission := range allowed {
+		if p.Includes(permission) && !slices.Contains(restricted, permission) {
+			restricted = append(restricted, permission)
+		}
+	}
+
+	return restricted
 }
 
 type PermissionModel struct {
-	DB *sql.DB
+	DB    *sql.DB
+	Cache *PermissionCache
 }
 
 func (m *PermissionModel) GetAllForUser(userid int64) (PermissionsList, error) {
+	key := permissionCacheKey{userID: userid}
+
+	permissions, generation, ok := m.Cache.get(key)
+	if ok {
+		return permissions, nil
+	}
+
 	stmt := ` SELECT permissions.code
 			FROM permissions
 			INNER JOIN users_permissions ON users_permissions.permission_id = permissions.id
-			INNER JOIN users ON users_permissions.user_id = users.id
-			WHERE users.id = $1`
+			WHERE users_permissions.user_id = $1
+			UNION
+			SELECT permissions.code
+			FROM permissions
+			INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+			INNER JOIN users_roles ON users_roles.role_id = roles_permissions.role_id
+			WHERE users_roles.user_id = $1`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -35,7 +136,7 @@ func (m *PermissionModel) GetAllForUser(userid int64) (PermissionsList, error) {
 	}
 	defer res.Close()
 
-	var permissions PermissionsList
+	permissions = nil
 
 	for res.Next() {
 		var perm string
@@ -52,16 +153,277 @@ func (m *PermissionModel) GetAllForUser(userid int64) (PermissionsList, error) {
 		return nil, err
 	}
 
+	m.Cache.set(key, generation, permissions)
+
 	return permissions, nil
 }
 
 func (m *PermissionModel) AddForUser(userid int64, codes ...string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := addUserPermissions(ctx, m.DB, userid, codes)
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userid)
+
+	return nil
+}
+
+func addUserPermissions(ctx context.Context, q queryer, userid int64, codes []string) error {
 	stmt := ` INSERT INTO users_permissions
-			SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+			SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
+			ON CONFLICT DO NOTHING`
+
+	_, err := q.ExecContext(ctx, stmt, userid, pq.Array(codes))
+	return err
+}
+
+func (m *PermissionModel) RemoveForUser(userid int64, codes ...string) error {
+	stmt := ` DELETE FROM users_permissions
+			USING permissions
+			WHERE users_permissions.permission_id = permissions.id
+			AND users_permissions.user_id = $1
+			AND permissions.code = ANY($2)`
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, stmt, userid, pq.Array(codes))
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userid)
+
+	return nil
+}
+
+// GetAllForMember returns the user's global permissions together with the
+// ones granted to them within the organization.
+func (m *PermissionModel) GetAllForMember(organizationID, userID int64) (PermissionsList, error) {
+	key := permissionCacheKey{userID: userID, organizationID: organizationID}
+
+	permissions, generation, ok := m.Cache.get(key)
+	if ok {
+		return permissions, nil
+	}
+
+	global, err := m.GetAllForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := ` SELECT permissions.code
+			FROM permissions
+			INNER JOIN organizations_users_permissions ON organizations_users_permissions.permission_id = permissions.id
+			WHERE organizations_users_permissions.organization_id = $1
+			AND organizations_users_permissions.user_id = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.QueryContext(ctx, stmt, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	permissions = slices.Clone(global)
+
+	for res.Next() {
+		var perm string
+
+		err := res.Scan(&perm)
+		if err != nil {
+			return nil, err
+		}
+
+		if !slices.Contains(permissions, perm) {
+			permissions = append(permissions, perm)
+		}
+	}
+
+	if err = res.Err(); err != nil {
+		return nil, err
+	}
+
+	m.Cache.set(key, generation, permissions)
+
+	return permissions, nil
+}
+
+// GetAllGrantedToMember returns only the permissions granted to the user
+// within the organization, without their global ones.
+func (m *PermissionModel) GetAllGrantedToMember(organizationID, userID int64) (PermissionsList, error) {
+	stmt := ` SELECT permissions.code
+			FROM permissions
+			INNER JOIN organizations_users_permissions ON organizations_users_permissions.permission_id = permissions.id
+			WHERE organizations_users_permissions.organization_id = $1
+			AND organizations_users_permissions.user_id = $2
+			ORDER BY permissions.code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.QueryContext(ctx, stmt, organizationID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	permissions := PermissionsList{}
+
+	for res.Next() {
+		var perm string
+
+		err := res.Scan(&perm)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, perm)
+	}
+
+	if err = res.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+// SetForMember replaces the permissions granted to the user within the
+// organization.
+func (m *PermissionModel) SetForMember(organizationID, userID int64, codes ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = setMemberPermissions(ctx, tx, organizationID, userID, codes)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userID)
+
+	return nil
+}
+
+func setMemberPermissions(ctx context.Context, tx *sql.Tx, organizationID, userID int64, codes []string) error {
+	stmt := ` DELETE FROM organizations_users_permissions
+			WHERE organization_id = $1 AND user_id = $2`
+
+	_, err := tx.ExecContext(ctx, stmt, organizationID, userID)
+	if err != nil {
+		return err
+	}
+
+	stmt = ` INSERT INTO organizations_users_permissions (organization_id, user_id, permission_id)
+			SELECT $1, $2, permissions.id FROM permissions WHERE permissions.code = ANY($3)`
+
+	_, err = tx.ExecContext(ctx, stmt, organizationID, userID, pq.Array(codes))
 	return err
 }
+
+func (m *PermissionModel) GetAll() ([]*Permission, error) {
+	stmt := ` SELECT id, code
+			FROM permissions
+			ORDER BY code`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	permissions := []*Permission{}
+
+	for res.Next() {
+		var permission Permission
+
+		err := res.Scan(&permission.ID, &permission.Code)
+		if err != nil {
+			return nil, err
+		}
+
+		permissions = append(permissions, &permission)
+	}
+
+	if err = res.Err(); err != nil {
+		return nil, err
+	}
+
+	return permissions, nil
+}
+
+func (m *PermissionModel) Insert(permission *Permission) error {
+	stmt := ` INSERT INTO permissions (code)
+			VALUES ($1)
+			RETURNING id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, permission.Code).Scan(&permission.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "permissions_code_key"`:
+			return ErrDuplicatePermission
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Unknown returns the codes that don't exist in the permissions table.
+func (m *PermissionModel) Unknown(codes ...string) ([]string, error) {
+	stmt := ` SELECT code
+			FROM unnest($1::text[]) AS code
+			WHERE code NOT IN (SELECT permissions.code FROM permissions)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.QueryContext(ctx, stmt, pq.Array(codes))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+
+	var unknown []string
+
+	for res.Next() {
+		var code string
+
+		err := res.Scan(&code)
+		if err != nil {
+			return nil, err
+		}
+
+		unknown = append(unknown, code)
+	}
+
+	if err = res.Err(); err != nil {
+		return nil, err
+	}
+
+	return unknown, nil
+}
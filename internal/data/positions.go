@@ -0,0 +1,106 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// positionScope names the rows of table matched by where, such as the items
+// of one list, ordered by their position column. Positions start at 1 and are
+// contiguous as far as these methods are concerned, but deleting a movie
+// cascades to its rows without closing the gaps, so the end of the scope is
+// taken from the highest position rather than the row count. The where clause
+// refers to args as $1, $2 and so on. Callers must serialise changes to the
+// same scope.
+type positionScope struct {
+	table string
+	where string
+	args  []any
+}
+
+// param returns the placeholder for the nth argument after the scope's own.
+func (s positionScope) param(n int) string {
+	return "$" + strconv.Itoa(len(s.args)+n)
+}
+
+func (s positionScope) with(args ...any) []any {
+	return append(slices.Clone(s.args), args...)
+}
+
+// place makes room for the movie at the given position and returns the
+// position it ended up with, and whether it already had a row to update
+// rather than insert. A zero position appends new rows and leaves existing
+// ones where they are; positions past the end are clamped to it.
+func (s positionScope) place(ctx context.Context, tx *sql.Tx, movieID int64, position int) (int, bool, error) {
+
+	var last int
+
+	stmt := fmt.Sprintf(`SELECT COALESCE(MAX(position), 0) FROM %s WHERE %s`, s.table, s.where)
+
+	err := tx.QueryRowContext(ctx, stmt, s.args...).Scan(&last)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var current int
+
+	stmt = fmt.Sprintf(`SELECT position FROM %s WHERE %s AND movie_id = %s`, s.table, s.where, s.param(1))
+
+	err = tx.QueryRowContext(ctx, stmt, s.with(movieID)...).Scan(&current)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if position == 0 || position > last+1 {
+			position = last + 1
+		}
+
+		// A new row moves in from just past the end.
+		return position, false, s.move(ctx, tx, last+1, position)
+	case err != nil:
+		return 0, false, err
+	}
+
+	if position == 0 {
+		position = current
+	}
+	position = min(position, last)
+
+	return position, true, s.move(ctx, tx, current, position)
+}
+
+// move shifts the rows between two positions to make room for the row moving
+// from one to the other.
+func (s positionScope) move(ctx context.Context, tx *sql.Tx, from, to int) error {
+
+	var stmt string
+
+	switch {
+	case to < from:
+		stmt = fmt.Sprintf(`UPDATE %s
+				SET position = position + 1
+				WHERE %s AND position >= %s AND position < %s`, s.table, s.where, s.param(1), s.param(2))
+	case to > from:
+		stmt = fmt.Sprintf(`UPDATE %s
+				SET position = position - 1
+				WHERE %s AND position > %s AND position <= %s`, s.table, s.where, s.param(2), s.param(1))
+	default:
+		return nil
+	}
+
+	_, err := tx.ExecContext(ctx, stmt, s.with(to, from)...)
+	return err
+}
+
+// close shifts the rows after a deleted one up to fill the gap it left.
+func (s positionScope) close(ctx context.Context, tx *sql.Tx, position int) error {
+
+	stmt := fmt.Sprintf(`UPDATE %s
+			SET position = position - 1
+			WHERE %s AND position > %s`, s.table, s.where, s.param(1))
+
+	_, err := tx.ExecContext(ctx, stmt, s.with(position)...)
+	return err
+}
@@ -0,0 +1,245 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"greenlight/internal/validator"
+	"time"
+)
+
+var ErrDuplicateReview = errors.New("duplicate review")
+
+type Review struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	MovieID   int64     `json:"movie_id"`
+	UserID    int64     `json:"user_id"`
+	UserName  string    `json:"user_name"`
+	Rating    int32     `json:"rating"`
+	Body      string    `json:"body"`
+	Version   int32     `json:"version"`
+}
+
+func ValidateReview(v *validator.Validator, review *Review) {
+	v.Check(review.Rating >= 1 && review.Rating <= 10, "rating", "must be between 1 and 10")
+	v.Check(len(review.Body) <= 5000, "body", "must not be more than 5000 bytes long")
+}
+
+type ReviewModel struct {
+	DB *sql.DB
+}
+
+func (m ReviewModel) Insert(review *Review) error {
+
+	stmt := `INSERT INTO reviews (movie_id, user_id, rating, body)
+			 VALUES ($1, $2, $3, $4)
+			 RETURNING id, created_at, updated_at, version`
+
+	args := []any{review.MovieID, review.UserID, review.Rating, review.Body}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&review.ID, &review.CreatedAt, &review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "reviews_movie_id_user_id_key"`:
+			return ErrDuplicateReview
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Get(movieID, id int64) (*Review, error) {
+
+	stmt := `SELECT reviews.id, reviews.created_at, reviews.updated_at, reviews.movie_id, reviews.user_id, users.name,
+				reviews.rating, reviews.body, reviews.version
+			 FROM reviews
+			 INNER JOIN users ON users.id = reviews.user_id
+			 WHERE reviews.id = $1 AND reviews.movie_id = $2`
+
+	var review Review
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id, movieID).Scan(
+		&review.ID,
+		&review.CreatedAt,
+		&review.UpdatedAt,
+		&review.MovieID,
+		&review.UserID,
+		&review.UserName,
+		&review.Rating,
+		&review.Body,
+		&review.Version,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &review, nil
+}
+
+func (m ReviewModel) GetAllForMovie(movieID int64, filters Filters) ([]*Review, Metadata, error) {
+
+	stmt := fmt.Sprintf(`SELECT COUNT(*) OVER(), reviews.id, reviews.created_at, reviews.updated_at, reviews.movie_id,
+				reviews.user_id, users.name, reviews.rating, reviews.body, reviews.version
+			 FROM reviews
+			 INNER JOIN users ON users.id = reviews.user_id
+			 WHERE reviews.movie_id = $1
+			 ORDER BY reviews.%s %s, reviews.id ASC
+			 LIMIT $2 OFFSET $3`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, movieID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&totalRecords,
+			&review.ID,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.MovieID,
+			&review.UserID,
+			&review.UserName,
+			&review.Rating,
+			&review.Body,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return reviews, metadata, nil
+}
+
+// GetAllForUser returns every review written by the user.
+func (m ReviewModel) GetAllForUser(userID int64) ([]*Review, error) {
+
+	stmt := `SELECT reviews.id, reviews.created_at, reviews.updated_at, reviews.movie_id, reviews.user_id, users.name,
+				reviews.rating, reviews.body, reviews.version
+			 FROM reviews
+			 INNER JOIN users ON users.id = reviews.user_id
+			 WHERE reviews.user_id = $1
+			 ORDER BY reviews.id`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := []*Review{}
+
+	for rows.Next() {
+		var review Review
+
+		err := rows.Scan(
+			&review.ID,
+			&review.CreatedAt,
+			&review.UpdatedAt,
+			&review.MovieID,
+			&review.UserID,
+			&review.UserName,
+			&review.Rating,
+			&review.Body,
+			&review.Version,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		reviews = append(reviews, &review)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reviews, nil
+}
+
+func (m ReviewModel) Update(review *Review) error {
+
+	stmt := `UPDATE reviews
+			 SET rating = $1, body = $2, updated_at = NOW(), version = version + 1
+			 WHERE id = $3 AND version = $4
+			 RETURNING updated_at, version`
+
+	args := []any{review.Rating, review.Body, review.ID, review.Version}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&review.UpdatedAt, &review.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m ReviewModel) Delete(id int64) error {
+
+	stmt := `DELETE FROM reviews
+			 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type Revocation struct {
+	Family string
+	Expiry time.Time
+}
+
+type RevocationModel struct {
+	DB *sql.DB
+}
+
+func (m RevocationModel) Insert(expiry time.Time, families ...string) error {
+
+	stmt := `INSERT INTO token_revocations (family, expiry)
+			 SELECT f, $2 FROM unnest($1::text[]) AS f
+			 ON CONFLICT (family) DO UPDATE SET expiry = GREATEST(token_revocations.expiry, EXCLUDED.expiry)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, pq.Array(families), expiry)
+	return err
+}
+
+func (m RevocationModel) GetAllActive() ([]Revocation, error) {
+
+	stmt := `SELECT family, expiry
+			 FROM token_revocations
+			 WHERE expiry > $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revocations []Revocation
+
+	for rows.Next() {
+		var revocation Revocation
+
+		err := rows.Scan(&revocation.Family, &revocation.Expiry)
+		if err != nil {
+			return nil, err
+		}
+
+		revocations = append(revocations, revocation)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revocations, nil
+}
+
+func (m RevocationModel) DeleteExpired() error {
+
+	stmt := `DELETE FROM token_revocations
+			 WHERE expiry <= $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, time.Now())
+	return err
+}
@@ -0,0 +1,310 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"greenlight/internal/validator"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateRole = errors.New("duplicate role")
+
+	RoleNameRx = regexp.MustCompile(`^[a-z0-9_-]+$`)
+)
+
+type Role struct {
+	ID          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Permissions PermissionsList `json:"permissions"`
+}
+
+func ValidateRole(v *validator.Validator, role *Role) {
+	v.Check(role.Name != "", "name", "must be provided")
+	v.Check(len(role.Name) <= 50, "name", "must not be more than 50 bytes long")
+	v.Check(validator.Matches(role.Name, RoleNameRx), "name", "must only contain lowercase letters, digits, '-' and '_'")
+	v.Check(len(role.Description) <= 500, "description", "must not be more than 500 bytes long")
+	v.Check(validator.Unique(role.Permissions), "permissions", "must not contain duplicate values")
+}
+
+type RoleModel struct {
+	DB    *sql.DB
+	Cache *PermissionCache
+}
+
+const roleColumns = `roles.id, roles.created_at, roles.name, roles.description,
+				ARRAY(SELECT permissions.code
+					  FROM permissions
+					  INNER JOIN roles_permissions ON roles_permissions.permission_id = permissions.id
+					  WHERE roles_permissions.role_id = roles.id
+					  ORDER BY permissions.code)`
+
+func (m RoleModel) Insert(role *Role) error {
+
+	stmt := `INSERT INTO roles (name, description)
+			 VALUES ($1, $2)
+			 RETURNING id, created_at`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, stmt, role.Name, role.Description).Scan(&role.ID, &role.CreatedAt)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "roles_name_key"`:
+			return ErrDuplicateRole
+		default:
+			return err
+		}
+	}
+
+	err = setRolePermissions(ctx, tx, role.ID, role.Permissions)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m RoleModel) Get(id int64) (*Role, error) {
+
+	stmt := `SELECT ` + roleColumns + `
+			 FROM roles
+			 WHERE roles.id = $1`
+
+	role := &Role{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(
+		&role.ID,
+		&role.CreatedAt,
+		&role.Name,
+		&role.Description,
+		pq.Array(&role.Permissions),
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return role, nil
+}
+
+func (m RoleModel) GetAll() ([]*Role, error) {
+
+	stmt := `SELECT ` + roleColumns + `
+			 FROM roles
+			 ORDER BY roles.name`
+
+	return m.query(stmt)
+}
+
+func (m RoleModel) GetAllForUser(userID int64) ([]*Role, error) {
+
+	stmt := `SELECT ` + roleColumns + `
+			 FROM roles
+			 INNER JOIN users_roles ON users_roles.role_id = roles.id
+			 WHERE users_roles.user_id = $1
+			 ORDER BY roles.name`
+
+	return m.query(stmt, userID)
+}
+
+func (m RoleModel) query(stmt string, args ...any) ([]*Role, error) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []*Role{}
+
+	for rows.Next() {
+		var role Role
+
+		err := rows.Scan(
+			&role.ID,
+			&role.CreatedAt,
+			&role.Name,
+			&role.Description,
+			pq.Array(&role.Permissions),
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		roles = append(roles, &role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// SetPermissions replaces the permission codes bundled in the role.
+func (m RoleModel) SetPermissions(roleID int64, codes ...string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = setRolePermissions(ctx, tx, roleID, codes)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return err
+	}
+
+	m.Cache.InvalidateAll()
+
+	return nil
+}
+
+func setRolePermissions(ctx context.Context, tx *sql.Tx, roleID int64, codes []string) error {
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM roles_permissions WHERE role_id = $1`, roleID)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO roles_permissions
+			 SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)`
+
+	_, err = tx.ExecContext(ctx, stmt, roleID, pq.Array(codes))
+	return err
+}
+
+func (m RoleModel) Delete(id int64) error {
+
+	stmt := `DELETE FROM roles
+			 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	m.Cache.InvalidateAll()
+
+	return nil
+}
+
+// Unknown returns the role names that don't exist.
+func (m RoleModel) Unknown(names ...string) ([]string, error) {
+
+	stmt := `SELECT name
+			 FROM unnest($1::text[]) AS name
+			 WHERE name NOT IN (SELECT roles.name FROM roles)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, pq.Array(names))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var unknown []string
+
+	for rows.Next() {
+		var name string
+
+		err := rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+
+		unknown = append(unknown, name)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return unknown, nil
+}
+
+func (m RoleModel) AssignToUser(userID int64, names ...string) error {
+
+	stmt := `INSERT INTO users_roles
+			 SELECT $1, roles.id FROM roles WHERE roles.name = ANY($2)
+			 ON CONFLICT DO NOTHING`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userID)
+
+	return nil
+}
+
+func (m RoleModel) RemoveFromUser(userID int64, names ...string) error {
+
+	stmt := `DELETE FROM users_roles
+			 USING roles
+			 WHERE users_roles.role_id = roles.id
+			 AND users_roles.user_id = $1
+			 AND roles.name = ANY($2)`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID, pq.Array(names))
+	if err != nil {
+		return err
+	}
+
+	m.Cache.Invalidate(userID)
+
+	return nil
+}
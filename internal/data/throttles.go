@@ -0,0 +1,143 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	ThrottleAccount = "account"
+	ThrottleIP      = "ip"
+)
+
+type LockoutPolicy struct {
+	Threshold   int
+	Window      time.Duration
+	BaseLockout time.Duration
+	MaxLockout  time.Duration
+}
+
+// lockout doubles the lock duration for every failure past the threshold.
+func (p LockoutPolicy) lockout(failures int) time.Duration {
+	if failures < p.Threshold {
+		return 0
+	}
+
+	duration := p.BaseLockout
+	for i := p.Threshold; i < failures && duration < p.MaxLockout; i++ {
+		duration *= 2
+	}
+
+	return min(duration, p.MaxLockout)
+}
+
+type LoginThrottle struct {
+	Kind          string     `json:"-"`
+	Identifier    string     `json:"-"`
+	Failures      int        `json:"failed_attempts"`
+	LastFailureAt *time.Time `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+func (t *LoginThrottle) Locked() bool {
+	return t.LockedUntil != nil && t.LockedUntil.After(time.Now())
+}
+
+type LoginThrottleModel struct {
+	DB *sql.DB
+}
+
+func (m LoginThrottleModel) Get(kind, identifier string) (*LoginThrottle, error) {
+
+	stmt := `SELECT kind, identifier, failures, last_failure_at, locked_until
+			 FROM login_throttles
+			 WHERE kind = $1 AND identifier = $2`
+
+	throttle := &LoginThrottle{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, kind, identifier).Scan(
+		&throttle.Kind,
+		&throttle.Identifier,
+		&throttle.Failures,
+		&throttle.LastFailureAt,
+		&throttle.LockedUntil,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return throttle, nil
+}
+
+// RecordFailure counts a failed login attempt and locks the subject once the
+// policy threshold is reached. Failures older than the policy window are
+// forgotten.
+func (m LoginThrottleModel) RecordFailure(kind, identifier string, policy LockoutPolicy) (*LoginThrottle, error) {
+
+	stmt := `INSERT INTO login_throttles (kind, identifier, failures, last_failure_at)
+			 VALUES ($1, $2, 1, NOW())
+			 ON CONFLICT (kind, identifier) DO UPDATE
+			 SET failures = CASE
+					WHEN login_throttles.last_failure_at < NOW() - make_interval(secs => $3) THEN 1
+					ELSE login_throttles.failures + 1
+				END,
+				last_failure_at = NOW()
+			 RETURNING kind, identifier, failures, last_failure_at, locked_until`
+
+	throttle := &LoginThrottle{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, kind, identifier, policy.Window.Seconds()).Scan(
+		&throttle.Kind,
+		&throttle.Identifier,
+		&throttle.Failures,
+		&throttle.LastFailureAt,
+		&throttle.LockedUntil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	lockout := policy.lockout(throttle.Failures)
+	if lockout == 0 {
+		return throttle, nil
+	}
+
+	lockedUntil := time.Now().Add(lockout)
+	throttle.LockedUntil = &lockedUntil
+
+	stmt = `UPDATE login_throttles
+			SET locked_until = $3
+			WHERE kind = $1 AND identifier = $2`
+
+	_, err = m.DB.ExecContext(ctx, stmt, kind, identifier, lockedUntil)
+	if err != nil {
+		return nil, err
+	}
+
+	return throttle, nil
+}
+
+func (m LoginThrottleModel) Reset(kind, identifier string) error {
+
+	stmt := `DELETE FROM login_throttles
+			 WHERE kind = $1 AND identifier = $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, kind, identifier)
+	return err
+}
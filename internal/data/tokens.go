@@ -6,21 +6,44 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/base32"
+	"errors"
 	"greenlight/internal/validator"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 const (
 	ScopeAuthentication = "authentication"
 	ScopeActivation     = "activation"
+	ScopePasswordReset  = "password-reset"
+	ScopeRefresh        = "refresh"
+	ScopeMFAPending     = "mfa-pending"
+	ScopeEmailChange    = "email-change"
+	ScopeInvitation     = "invitation"
+	ScopeOrgInvitation  = "organization-invitation"
 )
 
 type Token struct {
-	Plaintext string    `json:"token"`
-	Hash      []byte    `json:"-"`
-	UserID    int64     `json:"-"`
-	Expiry    time.Time `json:"expiry"`
-	Scope     string    `json:"-"`
+	Plaintext string     `json:"token"`
+	Hash      []byte     `json:"-"`
+	UserID    int64      `json:"-"`
+	Expiry    time.Time  `json:"expiry"`
+	Scope     string     `json:"-"`
+	IP        string     `json:"-"`
+	UserAgent string     `json:"-"`
+	Family    string     `json:"-"`
+	UsedAt    *time.Time `json:"-"`
+}
+
+type Session struct {
+	ID         string     `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Expiry     time.Time  `json:"expiry"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	Current    bool       `json:"current"`
 }
 
 func generateToken(userId int64, ttl time.Duration, scope string) (*Token, error) {
@@ -45,6 +68,17 @@ func generateToken(userId int64, ttl time.Duration, scope string) (*Token, error
 	return token, nil
 }
 
+func GenerateFamily() (string, error) {
+	randBytes := make([]byte, 16)
+
+	_, err := rand.Read(randBytes)
+	if err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(randBytes), nil
+}
+
 func ValidateTokenPlaintext(v *validator.Validator, plaintext string) {
 	v.Check(plaintext != "", "token", "must be provided")
 	v.Check(len(plaintext) == 26, "token", "length of token must be 26")
@@ -56,10 +90,10 @@ type TokenModel struct {
 
 func (m *TokenModel) Insert(token *Token) error {
 
-	stmt := `INSERT INTO tokens (hash,user_id,expiry,scope)
-			 VALUES ($1,$2,$3,$4)`
+	stmt := `INSERT INTO tokens (hash,user_id,expiry,scope,family,ip,user_agent)
+			 VALUES ($1,$2,$3,$4,$5,$6,$7)`
 
-	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope}
+	args := []any{token.Hash, token.UserID, token.Expiry, token.Scope, token.Family, token.IP, token.UserAgent}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
@@ -82,6 +116,32 @@ func (m *TokenModel) DeleteAllForUser(scope string, userID int64) error {
 	return err
 }
 
+func (m *TokenModel) DeleteAllSessionsForUser(userID int64) error {
+
+	stmt := `DELETE FROM tokens
+			 WHERE user_id=$1 AND scope = ANY($2)`
+
+	args := []any{userID, pq.Array([]string{ScopeAuthentication, ScopeRefresh})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+func (m *TokenModel) DeleteAllScopesForUser(userID int64) error {
+
+	stmt := `DELETE FROM tokens
+			 WHERE user_id=$1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, userID)
+	return err
+}
+
 func (m *TokenModel) New(userId int64, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userId, ttl, scope)
 	if err != nil {
@@ -95,3 +155,254 @@ func (m *TokenModel) New(userId int64, ttl time.Duration, scope string) (*Token,
 
 	return token, nil
 }
+
+func (m *TokenModel) NewForSession(userId int64, ttl time.Duration, scope, family, ip, userAgent string) (*Token, error) {
+	token, err := generateToken(userId, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Family = family
+	token.IP = ip
+	token.UserAgent = userAgent
+
+	err = m.Insert(token)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (m *TokenModel) GetByPlaintext(scope, tokenPlaintext string) (*Token, error) {
+
+	stmt := `SELECT hash, user_id, expiry, scope, family, used_at, ip, user_agent
+			 FROM tokens
+			 WHERE hash = $1 AND scope = $2 AND expiry > $3`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	args := []any{tokenHash[:], scope, time.Now()}
+
+	token := &Token{Plaintext: tokenPlaintext}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(
+		&token.Hash,
+		&token.UserID,
+		&token.Expiry,
+		&token.Scope,
+		&token.Family,
+		&token.UsedAt,
+		&token.IP,
+		&token.UserAgent,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+func (m *TokenModel) MarkUsed(token *Token) error {
+
+	stmt := `UPDATE tokens
+			 SET used_at = NOW()
+			 WHERE hash = $1 AND used_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, token.Hash)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+func (m *TokenModel) DeleteFamily(family string) error {
+	if family == "" {
+		return nil
+	}
+
+	stmt := `DELETE FROM tokens
+			 WHERE family = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, family)
+	return err
+}
+
+func (m *TokenModel) DeleteSessionForToken(tokenPlaintext string) error {
+
+	stmt := `DELETE FROM tokens
+			 WHERE hash = $1
+			 OR family = (SELECT family FROM tokens WHERE hash = $1 AND family <> '')`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, tokenHash[:])
+	return err
+}
+
+func (m *TokenModel) Touch(tokenPlaintext, ip, userAgent string) error {
+
+	stmt := `UPDATE tokens
+			 SET last_used_at = NOW(), ip = $2, user_agent = $3
+			 WHERE (hash = $1 OR family = (SELECT family FROM tokens WHERE hash = $1 AND family <> ''))
+			 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute' OR ip <> $2 OR user_agent <> $3)`
+
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	args := []any{tokenHash[:], ip, userAgent}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, args...)
+	return err
+}
+
+func (m *TokenModel) GetAllFamiliesForUser(userID int64) ([]string, error) {
+
+	stmt := `SELECT DISTINCT family
+			 FROM tokens
+			 WHERE user_id = $1 AND scope = ANY($2) AND family <> ''`
+
+	args := []any{userID, pq.Array([]string{ScopeAuthentication, ScopeRefresh})}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var families []string
+
+	for rows.Next() {
+		var family string
+
+		err := rows.Scan(&family)
+		if err != nil {
+			return nil, err
+		}
+
+		families = append(families, family)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return families, nil
+}
+
+func (m *TokenModel) GetAllSessionsForUser(userID int64, currentTokenPlaintext, currentFamily string) ([]*Session, error) {
+
+	stmt := `SELECT DISTINCT ON (family)
+				family,
+				MIN(created_at) OVER (PARTITION BY family),
+				last_used_at,
+				MAX(expiry) OVER (PARTITION BY family),
+				ip,
+				user_agent,
+				family = COALESCE((SELECT family FROM tokens WHERE hash = $4), $5)
+			 FROM tokens
+			 WHERE user_id = $1 AND scope = ANY($2) AND expiry > $3 AND used_at IS NULL AND family <> ''
+			 ORDER BY family, last_used_at DESC NULLS LAST`
+
+	currentHash := sha256.Sum256([]byte(currentTokenPlaintext))
+
+	args := []any{userID, pq.Array([]string{ScopeAuthentication, ScopeRefresh}), time.Now(), currentHash[:], currentFamily}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []*Session{}
+
+	for rows.Next() {
+		var session Session
+
+		err := rows.Scan(
+			&session.ID,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.Expiry,
+			&session.IP,
+			&session.UserAgent,
+			&session.Current,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func (m *TokenModel) DeleteSession(userID int64, sessionID string) error {
+	if sessionID == "" {
+		return ErrRecordNotFound
+	}
+
+	stmt := `DELETE FROM tokens
+			 WHERE family = $1 AND user_id = $2`
+
+	args := []any{sessionID, userID}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
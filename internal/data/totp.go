@@ -0,0 +1,274 @@
+package data
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base32"
+	"errors"
+	"greenlight/internal/validator"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrTOTPAlreadyEnabled = errors.New("two-factor authentication already enabled")
+
+type TOTP struct {
+	UserID       int64
+	CreatedAt    time.Time
+	Secret       []byte
+	Confirmed    bool
+	LastUsedStep int64
+}
+
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+
+	for i := range codes {
+		randBytes := make([]byte, 5)
+
+		_, err := rand.Read(randBytes)
+		if err != nil {
+			return nil, err
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(randBytes))
+		codes[i] = code[:4] + "-" + code[4:]
+	}
+
+	return codes, nil
+}
+
+func ValidateTOTPCode(v *validator.Validator, code string) {
+	v.Check(code != "", "code", "must be provided")
+	v.Check(len(code) == 6, "code", "must be 6 digits long")
+}
+
+type TOTPModel struct {
+	DB *sql.DB
+}
+
+// Enrol stores a new, unconfirmed secret for the user, replacing any earlier
+// enrolment that was never confirmed.
+func (m TOTPModel) Enrol(userID int64, secret []byte) error {
+
+	stmt := `INSERT INTO users_totp (user_id, secret)
+			 VALUES ($1, $2)
+			 ON CONFLICT (user_id) DO UPDATE
+			 SET secret = EXCLUDED.secret, created_at = NOW(), last_used_step = 0
+			 WHERE users_totp.confirmed = false`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, userID, secret)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrTOTPAlreadyEnabled
+	}
+
+	return nil
+}
+
+func (m TOTPModel) Get(userID int64) (*TOTP, error) {
+
+	stmt := `SELECT user_id, created_at, secret, confirmed, last_used_step
+			 FROM users_totp
+			 WHERE user_id = $1`
+
+	totp := &TOTP{}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, userID).Scan(
+		&totp.UserID,
+		&totp.CreatedAt,
+		&totp.Secret,
+		&totp.Confirmed,
+		&totp.LastUsedStep,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return totp, nil
+}
+
+// Enabled reports whether the user has a confirmed TOTP enrolment.
+func (m TOTPModel) Enabled(userID int64) (bool, error) {
+
+	totp, err := m.Get(userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrRecordNotFound):
+			return false, nil
+		default:
+			return false, err
+		}
+	}
+
+	return totp.Confirmed, nil
+}
+
+// UseStep records the time step of an accepted code. It returns
+// ErrEditConflict when that step, or a later one, was already used.
+func (m TOTPModel) UseStep(userID int64, step int64) error {
+
+	stmt := `UPDATE users_totp
+			 SET last_used_step = $2
+			 WHERE user_id = $1 AND last_used_step < $2`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, userID, step)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrEditConflict
+	}
+
+	return nil
+}
+
+// Confirm enables the enrolment and replaces the user's recovery codes.
+func (m TOTPModel) Confirm(userID int64, recoveryCodes []string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt := `UPDATE users_totp
+			 SET confirmed = true
+			 WHERE user_id = $1`
+
+	_, err = tx.ExecContext(ctx, stmt, userID)
+	if err != nil {
+		return err
+	}
+
+	err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m TOTPModel) ReplaceRecoveryCodes(userID int64, recoveryCodes []string) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = replaceRecoveryCodes(ctx, tx, userID, recoveryCodes)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, recoveryCodes []string) error {
+
+	_, err := tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	hashes := make([][]byte, len(recoveryCodes))
+	for i, code := range recoveryCodes {
+		hash := sha256.Sum256([]byte(code))
+		hashes[i] = hash[:]
+	}
+
+	stmt := `INSERT INTO recovery_codes (user_id, hash)
+			 SELECT $1, unnest($2::bytea[])`
+
+	_, err = tx.ExecContext(ctx, stmt, userID, pq.Array(hashes))
+	return err
+}
+
+// UseRecoveryCode marks a recovery code as used and reports whether it was
+// valid.
+func (m TOTPModel) UseRecoveryCode(userID int64, code string) (bool, error) {
+
+	stmt := `UPDATE recovery_codes
+			 SET used_at = NOW()
+			 WHERE user_id = $1 AND hash = $2 AND used_at IS NULL`
+
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, userID, hash[:])
+	if err != nil {
+		return false, err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return rowsAffected == 1, nil
+}
+
+func (m TOTPModel) Delete(userID int64) error {
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM users_totp WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
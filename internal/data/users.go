@@ -5,6 +5,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"errors"
+	"fmt"
 	"greenlight/internal/validator"
 	"time"
 
@@ -28,7 +29,7 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  password  `json:"-"`
 	Activated bool      `json:"activated"`
-	Version   int       `json:"-"`
+	Version   int       `json:"version"`
 }
 
 type password struct {
@@ -93,16 +94,21 @@ type UserModel struct {
 
 func (m UserModel) Insert(user *User) error {
 
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	return insertUser(ctx, m.DB, user)
+}
+
+func insertUser(ctx context.Context, q queryer, user *User) error {
+
 	stmt := `	INSERT INTO users (name,email,password_hash,activated)
 				VALUES ($1,$2,$3,$4)
 				RETURNING id,created_at,version`
 
 	args := []any{user.Name, user.Email, user.Password.hash, user.Activated}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
-
-	err := m.DB.QueryRowContext(ctx, stmt, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
+	err := q.QueryRowContext(ctx, stmt, args...).Scan(&user.ID, &user.CreatedAt, &user.Version)
 
 	if err != nil {
 		switch {
@@ -116,6 +122,38 @@ func (m UserModel) Insert(user *User) error {
 	return nil
 }
 
+func (m UserModel) Get(id int64) (*User, error) {
+	stmt := `
+			SELECT id,created_at,name,email,password_hash,activated,version
+			FROM users
+			WHERE id=$1`
+
+	var user User
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(
+		&user.ID,
+		&user.CreatedAt,
+		&user.Name,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+		&user.Version,
+	)
+
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
 func (m UserModel) GetByEmail(email string) (*User, error) {
 	stmt := `
 			SELECT id,created_at,name,email,password_hash,activated,version
@@ -225,3 +263,136 @@ func (m *UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error
 	return user, nil
 
 }
+
+func (m UserModel) ScheduleDeletion(id int64, at time.Time) error {
+
+	stmt := `UPDATE users
+			 SET deletion_scheduled_at = $2
+			 WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, stmt, id, at)
+	return err
+}
+
+func (m UserModel) CancelDeletion(id int64) error {
+
+	stmt := `UPDATE users
+			 SET deletion_scheduled_at = NULL
+			 WHERE id = $1 AND deletion_scheduled_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m UserModel) GetDeletionSchedule(id int64) (*time.Time, error) {
+
+	stmt := `SELECT deletion_scheduled_at
+			 FROM users
+			 WHERE id = $1`
+
+	var at *time.Time
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&at)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return at, nil
+}
+
+// DeleteScheduled hard deletes every user whose grace period has passed. Their
+// tokens, permissions and other owned rows go with them through ON DELETE
+// CASCADE.
+func (m UserModel) DeleteScheduled() (int64, error) {
+
+	stmt := `DELETE FROM users
+			 WHERE deletion_scheduled_at <= $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	res, err := m.DB.ExecContext(ctx, stmt, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+func (m UserModel) GetAll(search string, activated *bool, filters Filters) ([]*User, Metadata, error) {
+
+	stmt := fmt.Sprintf(`
+			SELECT COUNT(*) OVER(), id, created_at, name, email, password_hash, activated, version
+			FROM users
+			WHERE (name ILIKE '%%' || $1 || '%%' OR email ILIKE '%%' || $1 || '%%' OR $1 = '')
+			AND (activated = $2 OR $2 IS NULL)
+			ORDER BY %s %s, id ASC
+			LIMIT $3 OFFSET $4`, filters.sortColumn(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, search, activated, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	users := []*User{}
+
+	for rows.Next() {
+		var user User
+
+		err := rows.Scan(
+			&totalRecords,
+			&user.ID,
+			&user.CreatedAt,
+			&user.Name,
+			&user.Email,
+			&user.Password.hash,
+			&user.Activated,
+			&user.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		users = append(users, &user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := CalculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return users, metadata, nil
+}
@@ -0,0 +1,199 @@
+package jwt
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("expired token")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+type header struct {
+	Algorithm string `json:"alg"`
+	Type      string `json:"typ"`
+	KeyID     string `json:"kid"`
+}
+
+type Claims struct {
+	Subject   int64  `json:"sub"`
+	Issuer    string `json:"iss"`
+	Family    string `json:"sid"`
+	Activated bool   `json:"act"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// keyFile is the on-disk format of the signing keys. Keys are rotated by
+// adding a new entry, pointing "current" at it and removing the old entry once
+// every token signed with it has expired.
+type keyFile struct {
+	Current string `json:"current"`
+	Keys    []struct {
+		ID     string `json:"kid"`
+		Secret string `json:"secret"`
+	} `json:"keys"`
+}
+
+type KeySet struct {
+	mu      sync.RWMutex
+	path    string
+	current string
+	keys    map[string][]byte
+}
+
+func LoadKeySet(path string) (*KeySet, error) {
+	ks := &KeySet{path: path}
+
+	err := ks.Reload()
+	if err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+func (ks *KeySet) Reload() error {
+
+	js, err := os.ReadFile(ks.path)
+	if err != nil {
+		return err
+	}
+
+	var file keyFile
+
+	err = json.Unmarshal(js, &file)
+	if err != nil {
+		return fmt.Errorf("key file %s: %w", ks.path, err)
+	}
+
+	keys := make(map[string][]byte, len(file.Keys))
+
+	for _, k := range file.Keys {
+		secret, err := base64.StdEncoding.DecodeString(k.Secret)
+		if err != nil {
+			return fmt.Errorf("key %q: secret must be base64 encoded", k.ID)
+		}
+
+		if len(secret) < 32 {
+			return fmt.Errorf("key %q: secret must be at least 32 bytes", k.ID)
+		}
+
+		keys[k.ID] = secret
+	}
+
+	if _, ok := keys[file.Current]; !ok {
+		return fmt.Errorf("key file %s: current key %q not found", ks.path, file.Current)
+	}
+
+	ks.mu.Lock()
+	ks.current = file.Current
+	ks.keys = keys
+	ks.mu.Unlock()
+
+	return nil
+}
+
+func (ks *KeySet) Sign(claims Claims) (string, error) {
+
+	ks.mu.RLock()
+	kid := ks.current
+	secret := ks.keys[kid]
+	ks.mu.RUnlock()
+
+	headerJSON, err := json.Marshal(header{Algorithm: "HS256", Type: "JWT", KeyID: kid})
+	if err != nil {
+		return "", err
+	}
+
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := encode(headerJSON) + "." + encode(claimsJSON)
+
+	return unsigned + "." + encode(sign(secret, unsigned)), nil
+}
+
+func (ks *KeySet) Verify(token, issuer string) (*Claims, error) {
+
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var h header
+
+	err := decode(parts[0], &h)
+	if err != nil || h.Algorithm != "HS256" {
+		return nil, ErrInvalidToken
+	}
+
+	ks.mu.RLock()
+	secret, ok := ks.keys[h.KeyID]
+	ks.mu.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if !hmac.Equal(signature, sign(secret, parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	var claims Claims
+
+	err = decode(parts[1], &claims)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Issuer != issuer {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+func IsToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+func sign(secret []byte, unsigned string) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string, dst any) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(b, dst)
+}
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS tokens_family_idx;
+
+DELETE FROM tokens WHERE scope = 'refresh';
+
+ALTER TABLE tokens DROP COLUMN IF EXISTS used_at;
+ALTER TABLE tokens DROP COLUMN IF EXISTS family;
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS token_revocations (
+ family text PRIMARY KEY,
+ expiry timestamp(0) with time zone NOT NULL
+);
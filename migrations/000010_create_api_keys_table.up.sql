@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+ id bigserial PRIMARY KEY,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+ name text NOT NULL,
+ prefix text NOT NULL,
+ hash bytea UNIQUE NOT NULL,
+ expiry timestamp(0) with time zone,
+ last_used_at timestamp(0) with time zone,
+ version integer NOT NULL DEFAULT 1,
+ UNIQUE (user_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS api_keys_permissions (
+ api_key_id bigint NOT NULL REFERENCES api_keys ON DELETE CASCADE,
+ permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+ PRIMARY KEY (api_key_id, permission_id)
+);
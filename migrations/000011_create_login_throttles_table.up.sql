@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS login_throttles (
+ kind text NOT NULL,
+ identifier text NOT NULL,
+ failures integer NOT NULL DEFAULT 0,
+ last_failure_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ locked_until timestamp(0) with time zone,
+ PRIMARY KEY (kind, identifier)
+);
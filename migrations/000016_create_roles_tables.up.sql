@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS roles (
+ id bigserial PRIMARY KEY,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ name text UNIQUE NOT NULL,
+ description text NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS roles_permissions (
+ role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+ permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+ PRIMARY KEY (role_id, permission_id)
+);
+
+CREATE TABLE IF NOT EXISTS users_roles (
+ user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+ role_id bigint NOT NULL REFERENCES roles ON DELETE CASCADE,
+ PRIMARY KEY (user_id, role_id)
+);
+
+INSERT INTO roles (name, description)
+VALUES
+('viewer', 'Can browse the catalogue'),
+('editor', 'Can browse and edit the catalogue'),
+('admin', 'Can do everything, including managing users');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE (roles.name = 'viewer' AND permissions.code = 'movies:read')
+OR (roles.name = 'editor' AND permissions.code IN ('movies:read', 'movies:write'))
+OR (roles.name = 'admin');
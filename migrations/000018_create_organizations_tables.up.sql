@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS organizations (
+ id bigserial PRIMARY KEY,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ name text NOT NULL,
+ slug text UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS organizations_users (
+ organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+ user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ PRIMARY KEY (organization_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS organizations_users_user_id_idx ON organizations_users (user_id);
+
+CREATE TABLE IF NOT EXISTS organizations_users_permissions (
+ organization_id bigint NOT NULL,
+ user_id bigint NOT NULL,
+ permission_id bigint NOT NULL REFERENCES permissions ON DELETE CASCADE,
+ PRIMARY KEY (organization_id, user_id, permission_id),
+ FOREIGN KEY (organization_id, user_id) REFERENCES organizations_users ON DELETE CASCADE
+);
+
+-- Everything that existed before organizations belongs to the default one.
+INSERT INTO organizations (name, slug)
+VALUES ('Default', 'default');
+
+INSERT INTO organizations_users (organization_id, user_id)
+SELECT organizations.id, users.id
+FROM organizations, users
+WHERE organizations.slug = 'default';
+
+ALTER TABLE movies ADD COLUMN IF NOT EXISTS organization_id bigint REFERENCES organizations ON DELETE CASCADE;
+
+UPDATE movies SET organization_id = (SELECT id FROM organizations WHERE slug = 'default');
+
+ALTER TABLE movies ALTER COLUMN organization_id SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS movies_organization_id_idx ON movies (organization_id);
+
+INSERT INTO permissions (code)
+VALUES ('orgs:admin');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'orgs:admin';
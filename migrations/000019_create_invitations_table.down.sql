@@ -0,0 +1,3 @@
+DELETE FROM tokens WHERE scope = 'invitation';
+
+DROP TABLE IF EXISTS invitations;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS invitations (
+ hash bytea PRIMARY KEY REFERENCES tokens ON DELETE CASCADE,
+ email citext NOT NULL,
+ permissions text[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS invitations_email_idx ON invitations (email);
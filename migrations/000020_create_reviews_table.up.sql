@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS reviews (
+ id bigserial PRIMARY KEY,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+ user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+ rating integer NOT NULL,
+ body text NOT NULL DEFAULT '',
+ version integer NOT NULL DEFAULT 1,
+ CONSTRAINT reviews_rating_check CHECK (rating BETWEEN 1 AND 10),
+ CONSTRAINT reviews_movie_id_user_id_key UNIQUE (movie_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS reviews_user_id_idx ON reviews (user_id);
+
+INSERT INTO permissions (code)
+VALUES ('reviews:moderate');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'reviews:moderate';
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS collection_entries (
+ user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+ collection text NOT NULL,
+ movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ position integer NOT NULL,
+ notes text NOT NULL DEFAULT '',
+ PRIMARY KEY (user_id, collection, movie_id),
+ CONSTRAINT collection_entries_collection_check CHECK (collection IN ('watchlist', 'watched'))
+);
+
+CREATE INDEX IF NOT EXISTS collection_entries_movie_id_idx ON collection_entries (movie_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS lists_collaborators;
+DROP TABLE IF EXISTS lists_movies;
+DROP TABLE IF EXISTS lists;
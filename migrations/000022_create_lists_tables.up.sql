@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS lists (
+ id bigserial PRIMARY KEY,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ updated_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+ owner_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+ title text NOT NULL,
+ description text NOT NULL DEFAULT '',
+ visibility text NOT NULL DEFAULT 'private',
+ version integer NOT NULL DEFAULT 1,
+ CONSTRAINT lists_visibility_check CHECK (visibility IN ('private', 'unlisted', 'public'))
+);
+
+CREATE INDEX IF NOT EXISTS lists_organization_id_idx ON lists (organization_id);
+CREATE INDEX IF NOT EXISTS lists_owner_id_idx ON lists (owner_id);
+
+CREATE TABLE IF NOT EXISTS lists_movies (
+ list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+ movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ added_by bigint REFERENCES users ON DELETE SET NULL,
+ position integer NOT NULL,
+ notes text NOT NULL DEFAULT '',
+ PRIMARY KEY (list_id, movie_id)
+);
+
+CREATE INDEX IF NOT EXISTS lists_movies_movie_id_idx ON lists_movies (movie_id);
+
+CREATE TABLE IF NOT EXISTS lists_collaborators (
+ list_id bigint NOT NULL REFERENCES lists ON DELETE CASCADE,
+ user_id bigint NOT NULL REFERENCES users ON DELETE CASCADE,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ PRIMARY KEY (list_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS lists_collaborators_user_id_idx ON lists_collaborators (user_id);
@@ -0,0 +1,25 @@
+CREATE TABLE IF NOT EXISTS people (
+ id bigserial PRIMARY KEY,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+ name text NOT NULL,
+ birth_year integer,
+ bio text NOT NULL DEFAULT '',
+ version integer NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS people_organization_id_idx ON people (organization_id);
+CREATE INDEX IF NOT EXISTS people_name_idx ON people USING GIN (to_tsvector('simple', name));
+
+CREATE TABLE IF NOT EXISTS credits (
+ id bigserial PRIMARY KEY,
+ movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+ person_id bigint NOT NULL REFERENCES people ON DELETE CASCADE,
+ role text NOT NULL,
+ character text NOT NULL DEFAULT '',
+ billing_order integer NOT NULL DEFAULT 0,
+ CONSTRAINT credits_role_check CHECK (role IN ('director', 'writer', 'actor', 'producer', 'composer')),
+ CONSTRAINT credits_movie_id_person_id_role_character_key UNIQUE (movie_id, person_id, role, character)
+);
+
+CREATE INDEX IF NOT EXISTS credits_person_id_role_idx ON credits (person_id, role);
@@ -0,0 +1,100 @@
+CREATE TABLE IF NOT EXISTS genres (
+ id bigserial PRIMARY KEY,
+ created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+ slug text UNIQUE NOT NULL,
+ name text NOT NULL,
+ version integer NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS genre_aliases (
+ alias text PRIMARY KEY,
+ genre_id bigint NOT NULL REFERENCES genres ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS movies_genres (
+ movie_id bigint NOT NULL REFERENCES movies ON DELETE CASCADE,
+ genre_id bigint NOT NULL REFERENCES genres ON DELETE RESTRICT,
+ position integer NOT NULL,
+ PRIMARY KEY (movie_id, genre_id)
+);
+
+CREATE INDEX IF NOT EXISTS movies_genres_genre_id_idx ON movies_genres (genre_id);
+
+INSERT INTO genres (slug, name)
+VALUES
+ ('action', 'Action'),
+ ('adventure', 'Adventure'),
+ ('animation', 'Animation'),
+ ('biography', 'Biography'),
+ ('comedy', 'Comedy'),
+ ('crime', 'Crime'),
+ ('documentary', 'Documentary'),
+ ('drama', 'Drama'),
+ ('family', 'Family'),
+ ('fantasy', 'Fantasy'),
+ ('history', 'History'),
+ ('horror', 'Horror'),
+ ('music', 'Music'),
+ ('mystery', 'Mystery'),
+ ('romance', 'Romance'),
+ ('science-fiction', 'Science Fiction'),
+ ('sport', 'Sport'),
+ ('thriller', 'Thriller'),
+ ('war', 'War'),
+ ('western', 'Western')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO genre_aliases (alias, genre_id)
+SELECT aliases.alias, genres.id
+FROM (VALUES
+ ('sci-fi', 'science-fiction'),
+ ('scifi', 'science-fiction'),
+ ('sf', 'science-fiction'),
+ ('animated', 'animation'),
+ ('biopic', 'biography'),
+ ('historical', 'history'),
+ ('musical', 'music'),
+ ('romantic', 'romance'),
+ ('sports', 'sport'),
+ ('suspense', 'thriller')
+) AS aliases (alias, slug)
+INNER JOIN genres ON genres.slug = aliases.slug
+ON CONFLICT DO NOTHING;
+
+INSERT INTO permissions (code)
+VALUES ('genres:admin');
+
+INSERT INTO roles_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.code = 'genres:admin';
+
+-- Existing values are matched by slug, lowercased with runs of anything other
+-- than letters and digits replaced by a hyphen, against genre slugs and
+-- aliases. Values that match neither become new genres, so nothing is lost.
+CREATE TEMPORARY TABLE existing_genres AS
+SELECT movies.id AS movie_id,
+       existing.ordinality AS position,
+       existing.genre AS name,
+       trim(BOTH '-' FROM regexp_replace(lower(existing.genre), '[^a-z0-9]+', '-', 'g')) AS slug
+FROM movies, unnest(movies.genres) WITH ORDINALITY AS existing (genre, ordinality);
+
+INSERT INTO genres (slug, name)
+SELECT DISTINCT ON (existing_genres.slug) existing_genres.slug, initcap(existing_genres.name)
+FROM existing_genres
+WHERE existing_genres.slug <> ''
+AND NOT EXISTS (SELECT 1 FROM genres WHERE genres.slug = existing_genres.slug)
+AND NOT EXISTS (SELECT 1 FROM genre_aliases WHERE genre_aliases.alias = existing_genres.slug)
+ORDER BY existing_genres.slug, existing_genres.name;
+
+INSERT INTO movies_genres (movie_id, genre_id, position)
+SELECT existing_genres.movie_id, COALESCE(genres.id, genre_aliases.genre_id), MIN(existing_genres.position)
+FROM existing_genres
+LEFT JOIN genres ON genres.slug = existing_genres.slug
+LEFT JOIN genre_aliases ON genre_aliases.alias = existing_genres.slug
+WHERE genres.id IS NOT NULL OR genre_aliases.genre_id IS NOT NULL
+GROUP BY existing_genres.movie_id, COALESCE(genres.id, genre_aliases.genre_id);
+
+DROP TABLE existing_genres;
+
+ALTER TABLE movies DROP COLUMN genres;
@@ -0,0 +1,3 @@
+DELETE FROM tokens WHERE scope = 'organization-invitation';
+
+DROP TABLE IF EXISTS organization_invitations;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS organization_invitations (
+ hash bytea PRIMARY KEY REFERENCES tokens ON DELETE CASCADE,
+ organization_id bigint NOT NULL REFERENCES organizations ON DELETE CASCADE,
+ invited_by bigint REFERENCES users ON DELETE SET NULL,
+ permissions text[] NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitations_organization_id_idx ON organization_invitations (organization_id);